@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const (
+	envKeyCodeCommitAskpassFallback = "CODECOMMIT_ASKPASS_FALLBACK"
+
+	//askpassName is the name to link codecommit as for GIT_ASKPASS, which can not pass arguments
+	askpassName = "codecommit-askpass"
+)
+
+//askpassPromptRe matches git's prompts, eg. "Password for 'https://user@host/path': "
+var askpassPromptRe = regexp.MustCompile(`^(Username|Password) for '([a-z]+)://([^']+)': ?$`)
+
+//Askpass answers git's username and password prompts for CodeCommit URLs,
+//for tools which run git with GIT_ASKPASS rather than a credential helper.
+type Askpass struct {
+	CodeCommitCredentials
+}
+
+//isAskpass return true if the program was run as codecommit-askpass, eg. through a symlink
+func isAskpass(arg0 string) bool {
+	name := strings.TrimSuffix(filepath.Base(arg0), ".exe")
+	return name == askpassName
+}
+
+//parseAskpassPrompt return what git prompts for, "Username" or "Password",
+//and the request it prompts for. Usernames are not escaped in prompts, so
+//they may include the "/" of session tokens.
+func parseAskpassPrompt(prompt string) (string, GitRequest, bool) {
+	m := askpassPromptRe.FindStringSubmatch(prompt)
+	if m == nil {
+		return "", GitRequest{}, false
+	}
+	r := GitRequest{protocol: m[2]}
+	rest := m[3]
+	if i := strings.LastIndex(rest, "@"); i >= 0 {
+		r.username, rest = rest[:i], rest[i+1:]
+	}
+	parts := strings.SplitN(rest, "/", 2)
+	r.host = parts[0]
+	if len(parts) == 2 {
+		r.path = parts[1]
+	}
+	return m[1], r, true
+}
+
+func (a *Askpass) execute(cmd *cobra.Command, args []string) error {
+	f := cmd.Flags()
+	prompt := args[0]
+
+	what, r, ok := parseAskpassPrompt(prompt)
+	if !ok || !codecommit.IsCodeCommitURL(r.url()) {
+		return a.fallback(f, prompt)
+	}
+	if r.path == "" {
+		if err := a.setPath(f, &r); err != nil {
+			return err
+		}
+	}
+
+	if err := a.configureHelper(f, r); err != nil {
+		return a.describeError(err)
+	}
+	creds, err := a.daemonCredentials(f, r.url())
+	if err == nil && creds == nil {
+		if creds, err = a.getCreds(r.url()); err == nil {
+			err = a.checkSession()
+		}
+	}
+	if err != nil {
+		return a.describeError(err)
+	}
+
+	switch what {
+	case "Username":
+		fmt.Fprintln(os.Stdout, creds.Username)
+	case "Password":
+		if r.username != "" && r.username != creds.Username {
+			return fmt.Errorf("git prompts for the password of %s, which is not the username of the current AWS credentials", r.username)
+		}
+		fmt.Fprintln(os.Stdout, creds.Password)
+	}
+	return nil
+}
+
+//checkSession return an error if the credentials were assumed by this process.
+//git runs askpass for the username and again for the password, which must be
+//signed with the same session, kept by the credential daemon or in the cache.
+func (a *Askpass) checkSession() error {
+	if a.cache != nil && len(a.roles) > 0 {
+		return nil
+	}
+	v, err := a.sess.Config.Credentials.Get()
+	if err != nil {
+		return err
+	}
+	switch v.ProviderName {
+	case ssoProviderName:
+		if a.cache != nil {
+			return nil
+		}
+	case stscreds.ProviderName, stscreds.WebIdentityProviderName:
+		if len(a.roles) == 0 {
+			// the SDK assumes the role of the AWS profile, which is not cached
+			return fmt.Errorf(`the role the AWS SDK assumes for profile %q would be assumed again for the password git asks for after the username,
+run "codecommit credential-daemon &" and set --socket or %s, or set the role with --role-arn and --cache`,
+				helperProfile(a.profile), envKeyCodeCommitDaemonSocket)
+		}
+	default:
+		return nil
+	}
+	return fmt.Errorf(`the role would be assumed again for the password git asks for after the username,
+set --cache or %s, or run "codecommit credential-daemon &" and set --socket or %s`,
+		envKeyCodeCommitCache, envKeyCodeCommitDaemonSocket)
+}
+
+//setPath sets the repository path of r, which git only includes in prompts
+//when credential.useHttpPath is set, from the url flag.
+func (a *Askpass) setPath(f *pflag.FlagSet, r *GitRequest) error {
+	ref, err := f.GetString("url")
+	if err != nil {
+		return err
+	}
+	if ref != "" {
+		repo, err := parseRepository(ref, "", "")
+		if err != nil {
+			return err
+		}
+		if u := repo.URL(); strings.HasPrefix(u, r.protocol+"://"+r.host+"/") {
+			r.path = strings.TrimPrefix(u, r.protocol+"://"+r.host+"/")
+			return nil
+		}
+	}
+	return fmt.Errorf(`git did not include the repository path in the prompt, set %s or run:
+git config --global credential.https://%s.useHttpPath true`, envKeyCodeCommitURL, r.host)
+}
+
+//fallback passes prompts which are not for CodeCommit to the fallback askpass program, if set
+func (a *Askpass) fallback(f *pflag.FlagSet, prompt string) error {
+	askpass, err := f.GetString("fallback")
+	if err != nil {
+		return err
+	}
+	if askpass == "" {
+		return fmt.Errorf("unable to answer %q, set --fallback or %s to answer prompts for other hosts",
+			prompt, envKeyCodeCommitAskpassFallback)
+	}
+	answer, err := runAskpass(askpass, prompt)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprint(os.Stdout, answer)
+	return err
+}
+
+func newAskpassCmd() *cobra.Command {
+	a := &Askpass{}
+	cmd := &cobra.Command{
+		Use:   "askpass PROMPT",
+		Short: "Answer git's username and password prompts for CodeCommit, as GIT_ASKPASS",
+		Long: fmt.Sprintf(`Answer git's username and password prompts for CodeCommit, as GIT_ASKPASS
+
+For tools which run git with GIT_ASKPASS but do not support credential helpers.
+GIT_ASKPASS can not pass arguments, install it by linking to codecommit, which
+then runs this command:
+
+ln -s $(command -v codecommit) /usr/local/bin/%[1]s
+export GIT_ASKPASS=%[1]s
+
+The repository's AWS identity is resolved as for credential-helper, from the
+environment, eg. CODECOMMIT_ROLE_ARN, the repository's git config and the
+configuration file. Git asks for the username and the password separately, so
+assumed role credentials must be kept by the credential daemon, see --socket, or
+cached with --cache, for the password to be signed with those of the username.
+
+Git only includes the repository path, which passwords are signed for, in its
+prompts when credential.useHttpPath is set, otherwise the repository is read
+from %[2]s:
+
+git config --global credential.https://git-codecommit.us-east-1.amazonaws.com.useHttpPath true
+
+Prompts for other hosts are passed to the --fallback askpass program.
+
+%[3]s
+`, askpassName, envKeyCodeCommitURL, identityPrecedenceDoc),
+		RunE: a.execute,
+		Args: cobra.ExactArgs(1),
+	}
+
+	cmd.Flags().String("url", os.Getenv(envKeyCodeCommitURL),
+		fmt.Sprintf("the repository URL, ARN or name, when git's prompts do not include its path\nCan be set from the environment with %s",
+			envKeyCodeCommitURL))
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	addCacheFlag(cmd)
+	addClockSkewFlag(cmd)
+	addDaemonSocketFlag(cmd)
+	cmd.Flags().String("fallback", os.Getenv(envKeyCodeCommitAskpassFallback),
+		fmt.Sprintf(`askpass program for prompts which are not for CodeCommit, eg. for SSH keys
+Can be set from the environment with %s`, envKeyCodeCommitAskpassFallback))
+	return cmd
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+)
+
+// TestParseAskpassPrompt tests parsing of git's username and password prompts.
+func TestParseAskpassPrompt(t *testing.T) {
+	tests := []struct {
+		prompt   string
+		what     string
+		expected GitRequest
+	}{
+		{
+			prompt:   "Username for 'https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo': ",
+			what:     "Username",
+			expected: GitRequest{protocol: "https", host: "git-codecommit.us-east-1.amazonaws.com", path: "v1/repos/your-repo"},
+		},
+		{
+			prompt: "Password for 'https://AKID%IQo/b+=@git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo': ",
+			what:   "Password",
+			expected: GitRequest{protocol: "https", host: "git-codecommit.us-east-1.amazonaws.com", path: "v1/repos/your-repo",
+				username: "AKID%IQo/b+="},
+		},
+		{
+			prompt:   "Password for 'https://git-codecommit.us-east-1.amazonaws.com': ",
+			what:     "Password",
+			expected: GitRequest{protocol: "https", host: "git-codecommit.us-east-1.amazonaws.com"},
+		},
+	}
+	for _, test := range tests {
+		what, r, ok := parseAskpassPrompt(test.prompt)
+		if !ok || what != test.what || r.protocol != test.expected.protocol || r.host != test.expected.host ||
+			r.path != test.expected.path || r.username != test.expected.username {
+			t.Errorf("Unexpected parse of %q: %s %+v", test.prompt, what, r)
+		}
+	}
+
+	if _, _, ok := parseAskpassPrompt("Enter passphrase for key '/home/me/.ssh/id_rsa': "); ok {
+		t.Errorf("Expected SSH passphrase prompt not to be parsed")
+	}
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const (
+	envKeyCodeCommitCache    = "CODECOMMIT_CACHE"
+	envKeyCodeCommitCacheDir = "CODECOMMIT_CACHE_DIR"
+
+	cacheDirName    = "codecommit"
+	cacheFileSuffix = ".cred"
+	lockFileSuffix  = ".lock"
+
+	//cacheExpiryWindow cached credentials are refreshed this long before they expire,
+	//leaving git enough time to use a signature made from them.
+	cacheExpiryWindow = 5 * time.Minute
+)
+
+//credentialCache stores expiring AWS credentials on disk, encrypted with a key
+//derived from the secret of the identity they were retrieved with, eg. the
+//secret access key of the source credentials, which is not stored in the cache.
+//The cache directory and its files are only accessible by the owner.
+type credentialCache struct {
+	dir string
+}
+
+//cacheEntry is the decrypted form of cached credentials
+type cacheEntry struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	ProviderName    string
+	Expiration      time.Time
+
+	//Scope is the host/path the credentials were retrieved for
+	Scope string
+}
+
+func (e *cacheEntry) value() credentials.Value {
+	return credentials.Value{
+		AccessKeyID:     e.AccessKeyID,
+		SecretAccessKey: e.SecretAccessKey,
+		SessionToken:    e.SessionToken,
+		ProviderName:    e.ProviderName,
+	}
+}
+
+//sealedEntry is the on disk form of a cacheEntry, only its scope is not encrypted
+type sealedEntry struct {
+	Scope  string
+	Sealed []byte
+}
+
+//valid returns true if the entry can be used at now
+func (e *cacheEntry) valid(now time.Time) bool {
+	return now.Add(cacheExpiryWindow).Before(e.Expiration)
+}
+
+//newCredentialCache return a credentialCache rooted at dir, the user's cache
+//directory is used when dir is empty.
+func newCredentialCache(dir string) (*credentialCache, error) {
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(base, cacheDirName)
+	}
+	if err := checkFileLocks(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &credentialCache{dir: dir}, nil
+}
+
+//cacheKey return a file name safe key for parts
+func cacheKey(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *credentialCache) path(key string) string {
+	return filepath.Join(c.dir, key+cacheFileSuffix)
+}
+
+//lock takes an exclusive lock for key, shared by all processes using the cache.
+func (c *credentialCache) lock(key string) (func() error, error) {
+	f, err := os.OpenFile(filepath.Join(c.dir, key+lockFileSuffix), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		defer f.Close()
+		return unlockFile(f)
+	}, nil
+}
+
+//load return the entry for key decrypted with the key derived from secret,
+//or nil if there is no entry.
+func (c *credentialCache) load(key, secret string) (*cacheEntry, error) {
+	sealed, err := c.loadSealed(key)
+	if err != nil || sealed == nil {
+		return nil, err
+	}
+	aead, err := cacheAEAD(key, secret)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed.Sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("cache entry is truncated")
+	}
+	nonce, ciphertext := sealed.Sealed[:aead.NonceSize()], sealed.Sealed[aead.NonceSize():]
+	data, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	e := &cacheEntry{}
+	if err := json.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+//loadSealed return the encrypted entry for key, or nil if there is no entry.
+func (c *credentialCache) loadSealed(key string) (*sealedEntry, error) {
+	data, err := ioutil.ReadFile(c.path(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	sealed := &sealedEntry{}
+	if err := json.Unmarshal(data, sealed); err != nil {
+		return nil, err
+	}
+	return sealed, nil
+}
+
+//save atomically writes the entry for key, encrypted with the key derived from secret
+func (c *credentialCache) save(key, secret string, e *cacheEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	aead, err := cacheAEAD(key, secret)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	data, err = json.Marshal(&sealedEntry{Scope: e.Scope, Sealed: aead.Seal(nonce, nonce, data, []byte(key))})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.path(key), data, 0600)
+}
+
+//cacheAEAD return the cipher of the entry for key, its key is derived from
+//secret so that entries can only be read by processes with the same identity.
+func cacheAEAD(key, secret string) (cipher.AEAD, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("no secret to encrypt the cache entry with")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("codecommit cache\x00" + key))
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//remove the entry for key, it is not an error if there is no entry.
+func (c *credentialCache) remove(key string) error {
+	err := os.Remove(c.path(key))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+//keys return the keys of all entries in the cache
+func (c *credentialCache) keys() ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(c.dir, "*"+cacheFileSuffix))
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(matches))
+	for _, m := range matches {
+		keys = append(keys, strings.TrimSuffix(filepath.Base(m), cacheFileSuffix))
+	}
+	return keys, nil
+}
+
+//erase removes the entries for scope
+func (c *credentialCache) erase(scope string) error {
+	keys, err := c.keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		if err := c.eraseEntry(key, scope); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *credentialCache) eraseEntry(key, scope string) error {
+	unlock, err := c.lock(key)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	sealed, err := c.loadSealed(key)
+	if err != nil {
+		// unreadable entries are never used, drop them
+		return c.remove(key)
+	}
+	if sealed == nil || sealed.Scope != scope {
+		return nil
+	}
+	return c.remove(key)
+}
+
+//writeFileAtomic writes data to a temporary file in the same directory and renames it to path.
+//If path is a symlink, eg. to a .netrc kept with other dotfiles, its target is replaced.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+//cachedProvider is a credentials.Provider which reads through a credentialCache.
+//The wrapped provider must implement credentials.Expirer, its credentials are
+//only retrieved when the cache has no usable entry.
+type cachedProvider struct {
+	credentials.Expiry
+
+	cache    *credentialCache
+	key      string
+	secret   string
+	scope    string
+	provider credentials.Provider
+
+	now func() time.Time
+}
+
+//newCachedCredentials return credentials for provider cached under the
+//identity, role and scope (host/path) they were issued for, and encrypted
+//with the identity's secret.
+func newCachedCredentials(cache *credentialCache, provider credentials.Provider, identity, secret, roleARN, scope string) *credentials.Credentials {
+	return credentials.NewCredentials(&cachedProvider{
+		cache:    cache,
+		key:      cacheKey(identity, roleARN, scope),
+		secret:   secret,
+		scope:    scope,
+		provider: provider,
+		now:      time.Now,
+	})
+}
+
+//Retrieve return cached credentials if they are still valid, otherwise
+//retrieve and cache new ones. The cache lock is held while retrieving so
+//that concurrent processes share a single call to the wrapped provider.
+func (p *cachedProvider) Retrieve() (credentials.Value, error) {
+	unlock, err := p.cache.lock(p.key)
+	if err != nil {
+		return credentials.Value{}, err
+	}
+	defer unlock()
+
+	// entries which can not be decrypted, eg. after the secret was rotated, are replaced
+	if e, err := p.cache.load(p.key, p.secret); err == nil && e != nil && e.valid(p.now()) {
+		p.SetExpiration(e.Expiration, cacheExpiryWindow)
+		return e.value(), nil
+	}
+
+	v, err := p.provider.Retrieve()
+	if err != nil {
+		return v, err
+	}
+
+	expirer, ok := p.provider.(credentials.Expirer)
+	if !ok {
+		return v, fmt.Errorf("credentials from %s do not expire and can not be cached", v.ProviderName)
+	}
+	e := &cacheEntry{
+		AccessKeyID:     v.AccessKeyID,
+		SecretAccessKey: v.SecretAccessKey,
+		SessionToken:    v.SessionToken,
+		ProviderName:    v.ProviderName,
+		Expiration:      expirer.ExpiresAt(),
+		Scope:           p.scope,
+	}
+	if err := p.cache.save(p.key, p.secret, e); err != nil {
+		return v, err
+	}
+	p.SetExpiration(e.Expiration, cacheExpiryWindow)
+	return v, nil
+}
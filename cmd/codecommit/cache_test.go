@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// countingProvider is an expiring credentials.Provider which counts calls to Retrieve()
+type countingProvider struct {
+	credentials.Expiry
+	calls      int
+	expiration time.Time
+}
+
+func (p *countingProvider) Retrieve() (credentials.Value, error) {
+	p.calls++
+	p.SetExpiration(p.expiration, 0)
+	return credentials.Value{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+		ProviderName:    "countingProvider",
+	}, nil
+}
+
+func newTestCache(t *testing.T) (*credentialCache, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "TestCredentialCache-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	cache, err := newCredentialCache(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatalf("Failed to create cache, err=%v", err)
+	}
+	return cache, func() { os.RemoveAll(dir) }
+}
+
+// TestCredentialCacheRoundTrip tests that a saved entry is encrypted on disk, only accessible by the owner,
+// and can only be loaded with the secret it was saved with.
+func TestCredentialCacheRoundTrip(t *testing.T) {
+	cache, cleanup := newTestCache(t)
+	defer cleanup()
+
+	key := cacheKey("AKID", "arn:aws:iam::123456789012:role/test", "https://host/path")
+	expected := &cacheEntry{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+		Expiration:      time.Now().Add(time.Hour).UTC().Round(time.Second),
+	}
+	if err := cache.save(key, "SOURCE_SECRET", expected); err != nil {
+		t.Fatalf("Failed to save entry, err=%v", err)
+	}
+
+	raw, err := ioutil.ReadFile(cache.path(key))
+	if err != nil {
+		t.Fatalf("Failed to read entry, err=%v", err)
+	}
+	for _, secret := range []string{"SECRET", "TOKEN"} {
+		if bytes.Contains(raw, []byte(secret)) {
+			t.Fatalf("Cache entry contains plain text %q", secret)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(cache.dir, "*")); len(files) != 1 {
+		t.Fatalf("Expected no key file beside the entry, actual %v", files)
+	}
+
+	for path, mode := range map[string]os.FileMode{cache.path(key): 0600, cache.dir: 0700} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat %v, err=%v", path, err)
+		}
+		if fi.Mode().Perm() != mode {
+			t.Fatalf("Expected mode %v for %v, actual %v", mode, path, fi.Mode().Perm())
+		}
+	}
+
+	if _, err := cache.load(key, "OTHER_SECRET"); err == nil {
+		t.Fatalf("Expected error loading the entry with another secret")
+	}
+	actual, err := cache.load(key, "SOURCE_SECRET")
+	if err != nil {
+		t.Fatalf("Failed to load entry, err=%v", err)
+	}
+	if *actual != *expected {
+		t.Fatalf("Expected entry %v, actual %v", expected, actual)
+	}
+
+	if err := cache.remove(key); err != nil {
+		t.Fatalf("Failed to remove entry, err=%v", err)
+	}
+	actual, err = cache.load(key, "SOURCE_SECRET")
+	if err != nil || actual != nil {
+		t.Fatalf("Expected no entry after remove, actual %v, err=%v", actual, err)
+	}
+}
+
+// TestCachedProvider tests that a cachedProvider shares credentials until shortly before they expire.
+func TestCachedProvider(t *testing.T) {
+	cache, cleanup := newTestCache(t)
+	defer cleanup()
+
+	now := time.Now()
+	inner := &countingProvider{expiration: now.Add(time.Hour)}
+	retrieve := func(at time.Time) {
+		t.Helper()
+		p := &cachedProvider{cache: cache, key: cacheKey("test"), secret: "SOURCE_SECRET", provider: inner, now: func() time.Time { return at }}
+		v, err := p.Retrieve()
+		if err != nil {
+			t.Fatalf("Failed to retrieve credentials, err=%v", err)
+		}
+		if v.SessionToken != "TOKEN" {
+			t.Fatalf("Expected session token %q, actual %q", "TOKEN", v.SessionToken)
+		}
+	}
+
+	retrieve(now)
+	retrieve(now.Add(30 * time.Minute))
+	if inner.calls != 1 {
+		t.Fatalf("Expected 1 call to the wrapped provider, actual %d", inner.calls)
+	}
+
+	retrieve(now.Add(time.Hour - cacheExpiryWindow/2))
+	if inner.calls != 2 {
+		t.Fatalf("Expected expiring credentials to be refreshed, calls %d", inner.calls)
+	}
+}
+
+// TestCredentialCacheScope tests that erase only affects the entries for its host/path.
+func TestCredentialCacheScope(t *testing.T) {
+	cache, cleanup := newTestCache(t)
+	defer cleanup()
+
+	expiration := time.Now().Add(time.Hour)
+	scopes := map[string]string{
+		cacheKey("repo-a"): "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/repo-a",
+		cacheKey("repo-b"): "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/repo-b",
+	}
+	for key, scope := range scopes {
+		if err := cache.save(key, "SOURCE_SECRET", &cacheEntry{Scope: scope, Expiration: expiration}); err != nil {
+			t.Fatalf("Failed to save entry, err=%v", err)
+		}
+	}
+
+	if err := cache.erase(scopes[cacheKey("repo-a")]); err != nil {
+		t.Fatalf("Failed to erase entry, err=%v", err)
+	}
+	if e, err := cache.load(cacheKey("repo-a"), "SOURCE_SECRET"); err != nil || e != nil {
+		t.Fatalf("Expected erased entry, actual %v, err=%v", e, err)
+	}
+	if e, err := cache.load(cacheKey("repo-b"), "SOURCE_SECRET"); err != nil || e == nil {
+		t.Fatalf("Expected entry for other scope, actual %v, err=%v", e, err)
+	}
+}
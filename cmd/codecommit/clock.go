@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const (
+	envKeyCodeCommitCorrectClockSkew = "CODECOMMIT_CORRECT_CLOCK_SKEW"
+
+	//skewCheckTimeout limits how long git waits for the clock skew to be checked
+	skewCheckTimeout = 5 * time.Second
+)
+
+//addClockSkewFlag adds the --correct-clock-skew flag to cmd
+func addClockSkewFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("correct-clock-skew", os.Getenv(envKeyCodeCommitCorrectClockSkew) != "",
+		fmt.Sprintf(`sign with the CodeCommit server's time rather than local time, which costs a request to the server,
+otherwise the clock skew is checked when git rejects the credentials
+Can be set from the environment with %s`, envKeyCodeCommitCorrectClockSkew))
+}
+
+//cloneURLOptions return the codecommit.CloneURL options set by flags
+func cloneURLOptions(f *pflag.FlagSet) ([]func(*codecommit.CloneURL), error) {
+	correct, err := f.GetBool("correct-clock-skew")
+	if err != nil {
+		return nil, err
+	}
+	if !correct {
+		return nil, nil
+	}
+	return []func(*codecommit.CloneURL){codecommit.WithSkewCorrection(nil)}, nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const (
+	envKeyCodeCommitConfig = "CODECOMMIT_CONFIG"
+	envKeyXDGConfigHome    = "XDG_CONFIG_HOME"
+
+	configFileName   = "config.yaml"
+	gitConfigSection = "codecommit"
+
+	identityPrecedenceDoc = `The AWS profile, role chain and region of a repository are resolved from, in
+order of precedence:
+
+1. command line flags, and the profile of codecommit:: URLs
+2. environment variables, eg. AWS_PROFILE, CODECOMMIT_ROLE_ARN and AWS_REGION
+3. codecommit.* keys of the git config of the current repository, if one of its
+   remotes is the repository, eg.
+   git config codecommit.roleArn arn:aws:iam::123456789012:role/git
+   with the keys profile, region, roleArn, roleSessionName and externalId,
+   the role keys may be repeated (git config --add) for a chain of roles
+4. the first repository in ~/.config/codecommit/config.yaml, or $CODECOMMIT_CONFIG,
+   with a match glob matching the repository URL or name, eg.
+   repositories:
+   - match: https://git-codecommit.*.amazonaws.com/v1/repos/team-*
+     profile: team
+   - match: shared-*
+     region: eu-west-1
+     role_arn:
+     - arn:aws:iam::111111111111:role/pipeline
+     - arn:aws:iam::222222222222:role/git
+5. the AWS SDK defaults, eg. the default profile`
+)
+
+//identity is the AWS identity a repository is accessed with
+type identity struct {
+	Profile         string   `yaml:"profile"`
+	Region          string   `yaml:"region"`
+	RoleARN         []string `yaml:"role_arn"`
+	RoleSessionName []string `yaml:"role_session_name"`
+	ExternalID      []string `yaml:"external_id"`
+}
+
+//repositoryConfig is the identity of the repositories matching the glob Match
+type repositoryConfig struct {
+	Match    string `yaml:"match"`
+	identity `yaml:",inline"`
+}
+
+//config is the codecommit configuration file
+type config struct {
+	Repositories []repositoryConfig `yaml:"repositories"`
+}
+
+//configPath return the path of the configuration file
+func configPath() string {
+	if path := os.Getenv(envKeyCodeCommitConfig); path != "" {
+		return path
+	}
+	dir := os.Getenv(envKeyXDGConfigHome)
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, cacheDirName, configFileName)
+}
+
+//loadConfig return the configuration file at file, which is empty if the file does not exist
+func loadConfig(file string) (*config, error) {
+	c := &config{}
+	if file == "" {
+		return c, nil
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return nil, fmt.Errorf("invalid configuration file %s: %v", file, err)
+	}
+	for _, r := range c.Repositories {
+		if _, err := path.Match(r.Match, ""); err != nil || r.Match == "" {
+			return nil, fmt.Errorf("invalid configuration file %s: invalid match %q", file, r.Match)
+		}
+	}
+	return c, nil
+}
+
+//match return the identity of the first repository matching any of refs, nil if none match
+func (c *config) match(refs ...string) *identity {
+	for i := range c.Repositories {
+		for _, ref := range refs {
+			if ok, _ := path.Match(c.Repositories[i].Match, ref); ok {
+				return &c.Repositories[i].identity
+			}
+		}
+	}
+	return nil
+}
+
+//repositoryRefs return the forms of ref matched against the configuration
+//file: ref itself and, unless it is a bare name, the repository URL and name.
+func repositoryRefs(ref string) []string {
+	refs := []string{ref}
+	if r, err := codecommit.ParseRepository(ref, ""); err == nil {
+		refs = append(refs, r.URL(), r.Name)
+	}
+	return refs
+}
+
+//gitConfigIdentity return the identity set by the codecommit.* keys of the
+//git config of the repository in dir, which is empty outside a repository.
+func gitConfigIdentity(dir string) (*identity, error) {
+	id := &identity{}
+	cmd := exec.Command("git", "config", "--local", "--get-regexp", `^`+gitConfigSection+`\.`)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		// no matching keys, or dir is not a repository
+		if _, ok := err.(*exec.ExitError); ok {
+			return id, nil
+		}
+		return nil, err
+	}
+
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		parts := strings.SplitN(s.Text(), " ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch value := parts[1]; strings.TrimPrefix(parts[0], gitConfigSection+".") {
+		case "profile":
+			id.Profile = value
+		case "region":
+			id.Region = value
+		case "rolearn":
+			id.RoleARN = append(id.RoleARN, value)
+		case "rolesessionname":
+			id.RoleSessionName = append(id.RoleSessionName, value)
+		case "externalid":
+			id.ExternalID = append(id.ExternalID, value)
+		}
+	}
+	return id, s.Err()
+}
+
+//override return id with the fields set in o replacing its own
+func (id identity) override(o *identity) *identity {
+	if o.Profile != "" {
+		id.Profile = o.Profile
+	}
+	if o.Region != "" {
+		id.Region = o.Region
+	}
+	// a different role chain does not share the options of the replaced one
+	if len(o.RoleARN) > 0 {
+		id.RoleARN, id.RoleSessionName, id.ExternalID = o.RoleARN, nil, nil
+	}
+	if len(o.RoleSessionName) > 0 {
+		id.RoleSessionName = o.RoleSessionName
+	}
+	if len(o.ExternalID) > 0 {
+		id.ExternalID = o.ExternalID
+	}
+	return &id
+}
+
+//gitRemoteURLs return the fetch and push URLs of the remotes of the
+//repository in dir, which are empty outside a repository.
+func gitRemoteURLs(dir string) ([]string, error) {
+	cmd := exec.Command("git", "config", "--local", "--get-regexp", `^remote\..*\.(url|pushurl)$`)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		// no remotes, or dir is not a repository
+		if _, ok := err.(*exec.ExitError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var urls []string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if parts := strings.SplitN(line, " ", 2); len(parts) == 2 {
+			urls = append(urls, parts[1])
+		}
+	}
+	return urls, nil
+}
+
+//repositoryName return the name of the repository ref, and its region if
+//ref includes one, ok is false if ref is not a repository reference.
+func repositoryName(ref string) (name, region string, ok bool) {
+	if r, err := codecommit.ParseRepository(ref, ""); err == nil {
+		return r.Name, r.Region, true
+	}
+	if r, err := codecommit.ParseRemoteURL(ref); err == nil {
+		return r.Name, r.Region, true
+	}
+	if !strings.Contains(ref, ":") && codecommit.IsRepositoryReference(ref) {
+		return ref, "", true
+	}
+	return "", "", false
+}
+
+//sameRepository return true if a and b reference the same repository, their
+//regions are only compared when both include one.
+func sameRepository(a, b string) bool {
+	nameA, regionA, okA := repositoryName(a)
+	nameB, regionB, okB := repositoryName(b)
+	if !okA || !okB || nameA != nameB {
+		return false
+	}
+	return regionA == "" || regionB == "" || regionA == regionB
+}
+
+//isRepositoryDir return true if one of the remotes of the repository in dir is ref
+func isRepositoryDir(ref, dir string) (bool, error) {
+	urls, err := gitRemoteURLs(dir)
+	if err != nil {
+		return false, err
+	}
+	for _, url := range urls {
+		if sameRepository(ref, url) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+//resolveIdentity return the identity of the repository ref from the
+//configuration file and, if dir is not empty and one of its remotes is ref,
+//the git config of the repository in dir.
+func resolveIdentity(ref, dir string) (*identity, error) {
+	c, err := loadConfig(configPath())
+	if err != nil {
+		return nil, err
+	}
+	id := &identity{}
+	if m := c.match(repositoryRefs(ref)...); m != nil {
+		id = m
+	}
+	if dir == "" {
+		return id, nil
+	}
+	// the git config of another repository, eg. a superproject, does not apply
+	if ok, err := isRepositoryDir(ref, dir); err != nil || !ok {
+		return id, err
+	}
+	g, err := gitConfigIdentity(dir)
+	if err != nil {
+		return nil, err
+	}
+	return id.override(g), nil
+}
+
+//isSet return true if the flag name was set on the command line or from the environment
+func isSet(f *pflag.FlagSet, name string) bool {
+	flag := f.Lookup(name)
+	return flag != nil && (flag.Changed || (flag.DefValue != "" && flag.DefValue != "[]"))
+}
+
+//setFlags sets the flags of f which were set neither on the command line
+//nor from the environment to the identity's values.
+func (id *identity) setFlags(f *pflag.FlagSet) error {
+	values := map[string][]string{
+		"role-arn": id.RoleARN,
+	}
+	// the role options are per role, they do not apply to roles set otherwise
+	if !isSet(f, "role-arn") {
+		values["role-session-name"] = id.RoleSessionName
+		values["external-id"] = id.ExternalID
+	}
+	if id.Profile != "" {
+		values["profile"] = []string{id.Profile}
+	}
+	if id.Region != "" {
+		values["region"] = []string{id.Region}
+	}
+	for name, vs := range values {
+		if f.Lookup(name) == nil || isSet(f, name) {
+			continue
+		}
+		for _, v := range vs {
+			if err := f.Set(name, v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//saveFlags return a function restoring the values of f, so that commands for
+//several repositories can set the identity of each on the same flags.
+func saveFlags(f *pflag.FlagSet) func() {
+	type saved struct {
+		values  []string
+		changed bool
+	}
+	flags := map[*pflag.Flag]saved{}
+	f.VisitAll(func(flag *pflag.Flag) {
+		s := saved{changed: flag.Changed}
+		if sv, ok := flag.Value.(pflag.SliceValue); ok {
+			s.values = append([]string{}, sv.GetSlice()...)
+		} else {
+			s.values = []string{flag.Value.String()}
+		}
+		flags[flag] = s
+	})
+	return func() {
+		for flag, s := range flags {
+			if sv, ok := flag.Value.(pflag.SliceValue); ok {
+				sv.Replace(s.values)
+			} else {
+				flag.Value.Set(s.values[0])
+			}
+			flag.Changed = s.changed
+		}
+	}
+}
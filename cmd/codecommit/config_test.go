@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testConfig = `repositories:
+- match: https://git-codecommit.*.amazonaws.com/v1/repos/team-*
+  profile: team
+- match: shared-*
+  region: eu-west-1
+  role_arn:
+  - arn:aws:iam::111111111111:role/pipeline
+  - arn:aws:iam::222222222222:role/git
+  role_session_name: [ci]
+`
+
+func writeTestConfig(t *testing.T, dir, content string) string {
+	t.Helper()
+	file := filepath.Join(dir, configFileName)
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config, err=%v", err)
+	}
+	return file
+}
+
+// TestLoadConfig tests that repositories are matched against the globs of the configuration file.
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadConfig-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := loadConfig(writeTestConfig(t, dir, testConfig))
+	if err != nil {
+		t.Fatalf("Failed to load config, err=%v", err)
+	}
+
+	tests := []struct {
+		ref     string
+		profile string
+		roles   int
+	}{
+		{"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/team-api", "team", 0},
+		{"codecommit://team-api", "", 0},
+		{"arn:aws:codecommit:eu-west-1:123456789012:shared-lib", "", 2},
+		{"codecommit::eu-west-1://dev@shared-lib", "", 2},
+		{"other", "", 0},
+	}
+	for _, test := range tests {
+		id := c.match(repositoryRefs(test.ref)...)
+		if test.profile == "" && test.roles == 0 {
+			if id != nil {
+				t.Errorf("%s: Expected no match, actual %+v", test.ref, id)
+			}
+			continue
+		}
+		if id == nil || id.Profile != test.profile || len(id.RoleARN) != test.roles {
+			t.Errorf("%s: Expected profile %q and %d roles, actual %+v", test.ref, test.profile, test.roles, id)
+		}
+	}
+
+	if c, err := loadConfig(filepath.Join(dir, "missing.yaml")); err != nil || len(c.Repositories) != 0 {
+		t.Errorf("Expected empty config for missing file, actual %v, err=%v", c, err)
+	}
+	if _, err := loadConfig(writeTestConfig(t, dir, "repositories:\n- match: x\n  role: y\n")); err == nil {
+		t.Errorf("Expected error for unknown key")
+	}
+	if _, err := loadConfig(writeTestConfig(t, dir, "repositories:\n- match: '['\n")); err == nil {
+		t.Errorf("Expected error for invalid glob")
+	}
+}
+
+// TestGitConfigIdentity tests that the codecommit.* git config keys override the configuration file.
+func TestGitConfigIdentity(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestGitConfigIdentity-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if id, err := gitConfigIdentity(dir); err != nil || !reflect.DeepEqual(id, &identity{}) {
+		t.Errorf("Expected empty identity outside a repository, actual %+v, err=%v", id, err)
+	}
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "codecommit.region", "us-west-2"},
+		{"config", "--add", "codecommit.roleArn", "arn:aws:iam::333333333333:role/a"},
+		{"config", "--add", "codecommit.roleArn", "arn:aws:iam::333333333333:role/b"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed, err=%v: %s", args, err, out)
+		}
+	}
+	g, err := gitConfigIdentity(dir)
+	if err != nil {
+		t.Fatalf("Failed to read git config, err=%v", err)
+	}
+	expected := &identity{
+		Region:  "us-west-2",
+		RoleARN: []string{"arn:aws:iam::333333333333:role/a", "arn:aws:iam::333333333333:role/b"},
+	}
+	if !reflect.DeepEqual(g, expected) {
+		t.Errorf("Expected %+v, actual %+v", expected, g)
+	}
+
+	file := &identity{Profile: "team", Region: "eu-west-1", RoleARN: []string{"x"}, RoleSessionName: []string{"ci"}}
+	expected = &identity{Profile: "team", Region: "us-west-2", RoleARN: g.RoleARN}
+	if actual := file.override(g); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %+v, actual %+v", expected, actual)
+	}
+}
+
+// TestResolveIdentityOtherRepository tests that the git config only applies to the repositories of its remotes.
+func TestResolveIdentityOtherRepository(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestResolveIdentityOtherRepository-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	os.Setenv(envKeyCodeCommitConfig, filepath.Join(dir, "missing.yaml"))
+	defer os.Unsetenv(envKeyCodeCommitConfig)
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"remote", "add", "origin", "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/this"},
+		{"config", "codecommit.roleArn", "arn:aws:iam::333333333333:role/this"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed, err=%v: %s", args, err, out)
+		}
+	}
+
+	for ref, expected := range map[string]bool{
+		"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/this":      true,
+		"https://git-codecommit-fips.us-east-1.amazonaws.com/v1/repos/this": true,
+		"codecommit::us-east-1://this":                                      true,
+		"this":                                                              true,
+		"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/other":     false,
+		"https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/this":      false,
+		"arn:aws:codecommit:us-east-1:123456789012:other":                   false,
+	} {
+		id, err := resolveIdentity(ref, dir)
+		if err != nil {
+			t.Fatalf("Failed to resolve identity of %s, err=%v", ref, err)
+		}
+		if actual := len(id.RoleARN) == 1; actual != expected {
+			t.Errorf("Expected git config applied to %s %v, actual %+v", ref, expected, id)
+		}
+	}
+}
+
+// TestIdentitySetFlags tests that flags set on the command line or from the environment take precedence.
+func TestIdentitySetFlags(t *testing.T) {
+	id := &identity{
+		Region:          "eu-west-1",
+		RoleARN:         []string{"arn:aws:iam::111111111111:role/a", "arn:aws:iam::222222222222:role/b"},
+		RoleSessionName: []string{"ci"},
+	}
+
+	cmd := &cobra.Command{}
+	addRegionFlag(cmd)
+	addRoleFlags(cmd)
+	cmd.Flags().Parse([]string{"--region", "us-east-1"})
+	if err := id.setFlags(cmd.Flags()); err != nil {
+		t.Fatalf("Failed to set flags, err=%v", err)
+	}
+	chain, err := parseRoleChain(cmd.Flags())
+	if err != nil {
+		t.Fatalf("Failed to parse roles, err=%v", err)
+	}
+	if len(chain) != 2 || chain[1].sessionName != "ci" {
+		t.Errorf("Expected the identity's roles, actual %v", chain)
+	}
+	if region, _ := cmd.Flags().GetString("region"); region != "us-east-1" {
+		t.Errorf("Expected region flag to take precedence, actual %q", region)
+	}
+
+	cmd = &cobra.Command{}
+	addRoleFlags(cmd)
+	cmd.Flags().Parse([]string{"--role-arn", "arn:aws:iam::333333333333:role/c"})
+	if err := id.setFlags(cmd.Flags()); err != nil {
+		t.Fatalf("Failed to set flags, err=%v", err)
+	}
+	chain, err = parseRoleChain(cmd.Flags())
+	if err != nil {
+		t.Fatalf("Failed to parse roles, err=%v", err)
+	}
+	if len(chain) != 1 || chain[0].arn != "arn:aws:iam::333333333333:role/c" || chain[0].sessionName == "ci" {
+		t.Errorf("Expected only the role flag, actual %+v", chain[0])
+	}
+}
@@ -1,17 +1,17 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	nurl "net/url"
+	"net"
+	"net/http"
 	"os"
-	"regexp"
-	"text/template"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
-	stscreds "github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
 )
@@ -23,57 +23,46 @@ const (
 
 	helperTemplate = `username={{ .Credentials.Username }}
 password={{ .Credentials.Password }}
+password_expiry_utc={{ .Credentials.Expiry.Unix }}
 `
 	gitCredentialsHelperAPIDoc = "https://git-scm.com/docs/api-credentials#_credential_helpers"
 )
 
-//GitRequest contains elements from a parsed Git helper input
-//See https://git-scm.com/docs/api-credentials#_credential_helpers
-type GitRequest struct {
-	protocol string
-	path     string
-	host     string
-}
-
-func (g *GitRequest) url() string {
-	u := nurl.URL{
-		Host:   g.host,
-		Path:   g.path,
-		Scheme: g.protocol,
-	}
-	return u.String()
-}
-
 //Values for use in Templating
 type Values struct {
 	Credentials *codecommit.CodeCommitCredentials
+	//URL is the repository URL, and CloneURL the URL with the credentials embedded
+	URL      string
+	CloneURL string
+	Region   string
+	//Repository is the repository name
+	Repository string
+	Host       string
+	//Expiry is when the password stops being accepted
+	Expiry time.Time
+	//AccountID is that of the repository ARN, or else of the role assumed, empty if unknown
+	AccountID string
+	//Role is the ARN of the role assumed, the last of a chain, empty if none is
+	Role string
 }
 
 type CodeCommitCredentials struct {
 	sess    *session.Session
-	roleARN *string
+	roles   roleChain
 	region  *string
+	profile string
 	method  string
+	options []func(*codecommit.CloneURL)
+	//accountID of the repository, if referenced by ARN
+	accountID string
+
+	//cache assumed role credentials when set, scoped to cacheScope (host/path)
+	cache      *credentialCache
+	cacheScope string
 }
 
-func (c *CodeCommitCredentials) parseGitInput() GitRequest {
-	gitInputRe := regexp.MustCompile(`^(.+)=(.+)$`)
-	scanner := bufio.NewScanner(os.Stdin)
-	r := GitRequest{}
-	for scanner.Scan() {
-		match := gitInputRe.FindStringSubmatch(scanner.Text())
-		if match != nil {
-			switch match[1] {
-			case "protocol":
-				r.protocol = match[2]
-			case "host":
-				r.host = match[2]
-			case "path":
-				r.path = match[2]
-			}
-		}
-	}
-	return r
+func (c *CodeCommitCredentials) parseGitInput() (GitRequest, error) {
+	return parseGitRequest(os.Stdin)
 }
 
 func (c *CodeCommitCredentials) getCreds(url string) (*codecommit.CodeCommitCredentials, error) {
@@ -96,7 +85,7 @@ func (c *CodeCommitCredentials) cloneURL(url string) (*codecommit.CloneURL, erro
 		return nil, err
 	}
 
-	cloneURL, err := codecommit.NewCloneURL(sess, url)
+	cloneURL, err := codecommit.NewCloneURL(sess, url, c.options...)
 	if err != nil {
 		return nil, err
 	}
@@ -104,22 +93,46 @@ func (c *CodeCommitCredentials) cloneURL(url string) (*codecommit.CloneURL, erro
 
 }
 
-func (c *CodeCommitCredentials) emitCreds(url, format string) error {
-	creds, err := c.getCreds(url)
+func (c *CodeCommitCredentials) emitCreds(url string, write outputFunc) error {
+	values, err := c.values(url)
 	if err != nil {
 		return err
 	}
+	return write(os.Stdout, values)
+}
 
-	t := template.Must(template.New("format").Parse(format))
+//values return the Values of credentials for the repository url
+func (c *CodeCommitCredentials) values(url string) (*Values, error) {
+	creds, err := c.getCreds(url)
+	if err != nil {
+		return nil, err
+	}
+	repo, err := codecommit.ParseRepository(url, "")
+	if err != nil {
+		return nil, err
+	}
+	cloneURL, err := credentialURL(url, creds.Username, creds.Password)
+	if err != nil {
+		return nil, err
+	}
 
-	values := Values{
+	values := &Values{
 		Credentials: creds,
+		URL:         url,
+		CloneURL:    cloneURL,
+		Region:      repo.Region,
+		Repository:  repo.Name,
+		Host:        repo.Host,
+		Expiry:      creds.Expiry,
+		AccountID:   c.accountID,
 	}
-	err = t.Execute(os.Stdout, values)
-	if err != nil {
-		return err
+	if len(c.roles) > 0 {
+		values.Role = c.roles[len(c.roles)-1].arn
+		if values.AccountID == "" {
+			values.AccountID = arnAccountID(values.Role)
+		}
 	}
-	return nil
+	return values, nil
 }
 
 //session getter/setter returns *session.session
@@ -128,106 +141,390 @@ func (c *CodeCommitCredentials) session() (*session.Session, error) {
 		cfg := &aws.Config{
 			Region: c.region,
 		}
-		sess, err := session.NewSession(cfg)
+		sess, err := newSession(cfg, c.profile, c.cache)
 		if err != nil {
 			return nil, err
 		}
 
-		if c.roleARN != nil {
-			sess.Config.Credentials = stscreds.NewCredentials(sess, *c.roleARN)
+		if c.roles != nil {
+			creds, err := c.roles.credentials(sess, c.cache, c.cacheScope)
+			if err != nil {
+				return nil, err
+			}
+			sess.Config.Credentials = creds
 		}
 		c.sess = sess
 	}
 	return c.sess, nil
 }
 
+//setCache enables the credential cache for scope, see flagCache
+func (c *CodeCommitCredentials) setCache(f *pflag.FlagSet, scope string) error {
+	cache, err := flagCache(f)
+	if err != nil {
+		return err
+	}
+	c.cache = cache
+	c.cacheScope = scope
+	return nil
+}
+
+//flagCache return the credential cache if requested by the "cache" flag, or if
+//a role requires MFA so that the code is not prompted for on every request.
+//It return nil if the cache is not enabled.
+func flagCache(f *pflag.FlagSet) (*credentialCache, error) {
+	enabled, err := f.GetBool("cache")
+	if err != nil {
+		return nil, err
+	}
+	mfaSerial, err := f.GetString("mfa-serial")
+	if err != nil {
+		return nil, err
+	}
+	if !enabled && mfaSerial == "" {
+		return nil, nil
+	}
+	return newCredentialCache(os.Getenv(envKeyCodeCommitCacheDir))
+}
+
 func (c *CodeCommitCredentials) execute(cmd *cobra.Command, args []string) error {
 	f := cmd.Flags()
 
-	url, err := f.GetString("url")
+	write, err := parseOutput(f)
 	if err != nil {
 		return err
 	}
-	if url == "" {
-		return fmt.Errorf("URL not specified")
+	if watch, _ := f.GetBool("watch"); watch || f.Changed("output-file") || len(args) > 0 {
+		return executeCredentialFile(f, args, write)
 	}
 
-	format, err := f.GetString("template")
+	url, err := c.configure(f)
 	if err != nil {
 		return err
 	}
-	if format == "" {
-		format = helperTemplate
+	return c.describeError(c.emitCreds(url, write))
+}
+
+//configure sets up c from the url, region, role-arn, cache and clock skew
+//flags and return the CodeCommit URL of the repository.
+func (c *CodeCommitCredentials) configure(f *pflag.FlagSet) (string, error) {
+	ref, err := f.GetString("url")
+	if err != nil {
+		return "", err
+	}
+	if ref == "" {
+		return "", fmt.Errorf("URL not specified")
+	}
+	return c.configureRepository(f, ref)
+}
+
+//configureRepository sets up c for the repository ref from the region,
+//role-arn, cache and clock skew flags and return its CodeCommit URL.
+func (c *CodeCommitCredentials) configureRepository(f *pflag.FlagSet, ref string) (string, error) {
+	id, err := resolveIdentity(ref, ".")
+	if err != nil {
+		return "", err
+	}
+	if err := id.setFlags(f); err != nil {
+		return "", err
+	}
+
+	region, err := f.GetString("region")
+	if err != nil {
+		return "", err
+	}
+	profile, err := f.GetString("profile")
+	if err != nil {
+		return "", err
+	}
+	repo, err := parseRepository(ref, region, profile)
+	if err != nil {
+		return "", err
+	}
+	if c.profile, err = parseProfile(f, repo); err != nil {
+		return "", err
+	}
+	c.accountID = repo.AccountID
+	url := repo.URL()
+
+	roles, err := parseRoleChain(f)
+	if err != nil {
+		return "", err
 	}
+	if err := roles.checkPartition(&repo.Endpoint); err != nil {
+		return "", err
+	}
+	c.roles = roles
+	c.region = &repo.Region
+
+	if err := c.setCache(f, url); err != nil {
+		return "", err
+	}
+	if c.options, err = cloneURLOptions(f); err != nil {
+		return "", err
+	}
+	return url, nil
+}
+
+//parseRegion return the region of the CodeCommit endpoint for url, checking
+//that roles, if set, are in the same partition.
+func parseRegion(url string, roles roleChain) (string, error) {
+	e, err := codecommit.ParseEndpoint(url)
+	if err != nil {
+		return "", err
+	}
+	if err := roles.checkPartition(e); err != nil {
+		return "", err
+	}
+	return e.Region, nil
+}
 
-	roleARN, err := f.GetString("role-arn")
+//describeError return an actionable error for err
+func (c *CodeCommitCredentials) describeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return describeError(err, c.profile, c.roles.String())
+}
+
+func (c *CodeCommitCredentials) executeCredentialHelper(cmd *cobra.Command, args []string) error {
+	c.method = args[0]
+	r, err := c.parseGitInput()
 	if err != nil {
 		return err
 	}
-	if roleARN != "" && os.Getenv(envKeyAwsProfile) != "" {
-		return fmt.Errorf("only one of role arn or profile should be set")
+
+	// leave other hosts to the next helper git is configured with, or the fallback helper
+	if !codecommit.IsCodeCommitURL(r.url()) {
+		return c.fallback(cmd.Flags(), r)
+	}
+
+	switch c.method {
+	case "get":
+		return c.get(cmd.Flags(), r)
+	case "store":
+		// passwords are signed for every request, there is nothing to store
+		return nil
+	case "erase":
+		return c.erase(cmd.Flags(), r)
+	default:
+		// helpers must ignore operations they do not understand
+		return nil
 	}
-	if roleARN != "" {
-		c.roleARN = &roleARN
+}
+
+//get emits credentials for the requested URL, on failure git is told to quit
+//rather than fall back to prompting for a username and password.
+func (c *CodeCommitCredentials) get(f *pflag.FlagSet, r GitRequest) error {
+	if err := c.emitHelperCreds(f, r); err != nil {
+		fmt.Fprintln(os.Stdout, "quit=1")
+		return c.describeError(err)
 	}
-	region, err := codecommit.ParseRegion(url)
+	return nil
+}
+
+func (c *CodeCommitCredentials) emitHelperCreds(f *pflag.FlagSet, r GitRequest) error {
+	// passwords are signed for the repository path, which git omits by default
+	if r.path == "" {
+		return fmt.Errorf(`git did not send the repository path, set credential.useHttpPath:
+git config --global credential.%s://%s.useHttpPath true`, r.protocol, r.host)
+	}
+
+	if err := c.configureHelper(f, r); err != nil {
+		return err
+	}
+
+	creds, err := c.daemonCredentials(f, r.url())
+	if err == nil && creds == nil {
+		creds, err = c.getCreds(r.url())
+	}
+	if err != nil {
+		return err
+	}
+	// git only reads the credentials, the URL may not be a canonical repository URL
+	return outputs["helper"](os.Stdout, &Values{Credentials: creds})
+}
+
+//configureHelper sets up c for the request r from the flags, and the
+//identity set for the repository.
+func (c *CodeCommitCredentials) configureHelper(f *pflag.FlagSet, r GitRequest) error {
+	// git runs helpers in the repository, its git config may override the identity
+	id, err := resolveIdentity(r.url(), ".")
+	if err != nil {
+		return err
+	}
+	if err := id.setFlags(f); err != nil {
+		return err
+	}
+	if c.profile, err = parseProfile(f, nil); err != nil {
+		return err
+	}
+
+	roles, err := parseRoleChain(f)
+	if err != nil {
+		return err
+	}
+	c.roles = roles
+
+	region, err := parseRegion(r.host, c.roles)
 	if err != nil {
 		return err
 	}
 	c.region = &region
 
-	return c.emitCreds(url, format)
+	if err := c.setCache(f, r.url()); err != nil {
+		return err
+	}
+	if c.options, err = cloneURLOptions(f); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (c *CodeCommitCredentials) executeCredentialHelper(cmd *cobra.Command, args []string) error {
-	r := c.parseGitInput()
+//daemonCredentials return credentials for url signed by the credential
+//daemon, nil if it is not running or can not sign for c's identity.
+func (c *CodeCommitCredentials) daemonCredentials(f *pflag.FlagSet, url string) (*codecommit.CodeCommitCredentials, error) {
+	socket, err := f.GetString("socket")
+	if err != nil || socket == "" {
+		return nil, err
+	}
+	req := c.daemonRequest(daemonActionGet, url)
+	if req == nil {
+		return nil, nil
+	}
+	if req.CorrectClockSkew, err = f.GetBool("correct-clock-skew"); err != nil {
+		return nil, err
+	}
+	resp, err := callDaemon(socket, req)
+	if _, ok := err.(net.Error); ok {
+		// the daemon is not running
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return resp.Credentials, nil
+}
 
-	if codecommit.IsCodeCommitURL(r.url()) {
-		if r, isset := os.LookupEnv(envKeyCodeCommitRoleARN); isset {
-			if os.Getenv(envKeyAwsProfile) != "" {
-				return fmt.Errorf("only one of role arn or profile should be set")
-			}
-			c.roleARN = &r
-		}
+//fallback passes requests for hosts other than CodeCommit to the fallback
+//helper, if one is set. Otherwise nothing is emitted.
+func (c *CodeCommitCredentials) fallback(f *pflag.FlagSet, r GitRequest) error {
+	helper, err := f.GetString("fallback")
+	if err != nil {
+		return err
+	}
+	if helper == "" {
+		return nil
+	}
+	return runFallbackHelper(helper, c.method, r, os.Stdout, os.Stderr)
+}
 
-		region, err := codecommit.ParseRegion(r.host)
-		if err != nil {
+//erase invalidates cached credentials for the requested URL, git calls
+//erase when the credentials were rejected. Unless it is corrected, a warning
+//is logged if clock skew is why they were rejected.
+func (c *CodeCommitCredentials) erase(f *pflag.FlagSet, r GitRequest) error {
+	if err := c.configureHelper(f, r); err != nil {
+		return err
+	}
+	if len(c.options) == 0 {
+		// errors are ignored, the server may not be reachable
+		codecommit.CheckClockSkew(&http.Client{Timeout: skewCheckTimeout}, r.host)
+	}
+	if socket, err := f.GetString("socket"); err == nil && socket != "" {
+		if req := c.daemonRequest(daemonActionErase, r.url()); req != nil {
+			// the daemon may not be running
+			callDaemon(socket, req)
+		}
+	}
+	if c.cache == nil {
+		return nil
+	}
+	// a rejected session of a role assumed with an MFA code is not reused either
+	for _, scope := range append([]string{c.cacheScope}, c.roles.mfaScopes()...) {
+		if err := c.cache.erase(scope); err != nil {
 			return err
 		}
-		c.region = &region
 	}
-
-	return c.emitCreds(r.url(), helperTemplate)
+	return nil
 }
 
 func newCredentialsCmd() *cobra.Command {
 	c := &CodeCommitCredentials{}
 	cmd := &cobra.Command{
-		Use:   "credential [options]",
+		Use:   "credential [options] [URL...]",
 		Short: "Emit credentials for URL for method",
 		Long: fmt.Sprintf(`Emit CodeCommit credentials
 
 The CodeCommit URL can alternately be set from the environment variable %q.
 
-Output can be templated using standard Go templating on the Credentials object
+%s
+
+The output format is set with --output, one of:
+
+helper  Git credential helper output (the default)
+json    a JSON object of the credentials, repository, expiry and role
+env     shell export statements, eg. eval "$(codecommit credential --output env)"
+netrc   a .netrc machine entry
+url     the repository URL with the credentials embedded
+git-credentials
+        the git credential-store file format, the same as url
+
+Output can instead be templated using standard Go templating on the Values object,
+with the fields Credentials (Username, Password and Expiry), URL, CloneURL, Region,
+Repository, Host, Expiry, AccountID and Role.
+
+Several repositories can be given as arguments, their credentials are written
+together, in the git-credentials or netrc format.
+
+With --output-file the credentials are written to a file, atomically and only
+readable by its owner. With --watch the command runs in the foreground and
+rewrites the file before the credentials in it expire, for tools which read a
+mounted git-credentials or .netrc file rather than running a credential helper:
+
+codecommit credential --watch --output git-credentials --output-file /creds/git-credentials \
+  --ready-file /tmp/ready https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo
+
+--ready-file is written with the expiry of the credentials once the file is
+written. Failed refreshes are retried, once the credentials in the file have
+expired the command exits with an error.
 
 Templating example(s):
-For standard Git credential helper output (the default)
+For standard Git credential helper output
 codecommit credential --url https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo \
 --template '%s'
-`, envKeyCodeCommitURL, helperTemplate),
+
+%s
+`, envKeyCodeCommitURL, repositoryFormsDoc, helperTemplate, identityPrecedenceDoc),
 		RunE: c.execute,
-		Args: cobra.ExactArgs(0),
+		Args: cobra.ArbitraryArgs,
 	}
 
 	cmd.Flags().String("url", os.Getenv(envKeyCodeCommitURL),
-		fmt.Sprintf("emit credentials for URL\nCan be set from the environment with %s",
+		fmt.Sprintf("emit credentials for the repository URL, ARN or name\nCan be set from the environment with %s",
 			envKeyCodeCommitURL))
+	addRegionFlag(cmd)
+	cmd.Flags().String("output", "helper",
+		fmt.Sprintf("output format, one of %s", strings.Join(outputNames(), ", ")))
 	cmd.Flags().String("template", "", "template output (Go templating)")
-	cmd.Flags().String("role-arn", os.Getenv(envKeyCodeCommitRoleARN), "role to assume when retrieving aws credentials, requires 'AWS_ACCESS_KEY_ID' and 'AWS_SECRET_KEY_ID' env vars to be set")
+	cmd.Flags().String("output-file", "", "write the output to a file, rather than stdout")
+	cmd.Flags().Bool("watch", false, "keep the output file refreshed before the credentials expire")
+	cmd.Flags().String("ready-file", "", "file written once the output file is written, for readiness probes")
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	addCacheFlag(cmd)
+	addClockSkewFlag(cmd)
 	return cmd
 }
 
+//addCacheFlag adds the --cache flag to cmd
+func addCacheFlag(cmd *cobra.Command) {
+	cmd.Flags().Bool("cache", os.Getenv(envKeyCodeCommitCache) != "",
+		fmt.Sprintf(`cache assumed role credentials on disk until shortly before they expire, encrypted
+with the secret of the source credentials, not supported where file locks are not available
+Can be set from the environment with %s, the cache directory can be set with %s`,
+			envKeyCodeCommitCache, envKeyCodeCommitCacheDir))
+}
+
 func newCredentialHelperCmd() *cobra.Command {
 	c := &CodeCommitCredentials{}
 	cmd := &cobra.Command{
@@ -242,9 +539,56 @@ Example usage:
 git clone --config=credential.helper='!codecommit credential-helper $@' \
   --config=credential.UseHttpPath=true \
    https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo .
-`, gitCredentialsHelperAPIDoc),
-		RunE: c.executeCredentialHelper,
-		Args: cobra.ExactArgs(1),
+
+A role to assume, and the options to assume it with, can be set with flags or
+from the environment, eg. CODECOMMIT_ROLE_ARN and CODECOMMIT_ROLE_SESSION_NAME:
+
+git config --global credential.helper \
+  '!codecommit credential-helper --role-arn arn:aws:iam::123456789012:role/git --role-session-name "$USER" $@'
+
+Repeat --role-arn, or comma separate CODECOMMIT_ROLE_ARN, to assume a chain of
+roles, each with the credentials of the previous one. The first role is assumed
+with the credentials of --profile, or AWS_PROFILE, if set:
+
+git config --global credential.helper \
+  '!codecommit credential-helper --profile dev --role-arn arn:aws:iam::123456789012:role/git $@'
+
+If the first role requires MFA set --mfa-serial, the code is prompted for on
+/dev/tty, or by the --mfa-askpass program, and the role session is cached until
+it expires.
+
+In CI and Kubernetes the first role can instead be assumed with an OIDC token,
+read from --web-identity-token-file, eg. $AWS_WEB_IDENTITY_TOKEN_FILE, or from
+the environment variable named by --web-identity-token-env.
+
+When assuming a role, add --cache to share the role's credentials between
+git processes until shortly before they expire:
+
+git config --global credential.helper '!codecommit credential-helper --cache $@'
+
+Run "codecommit credential-daemon" to keep credentials in memory between git
+processes, the helper uses the daemon when it is running:
+
+codecommit credential-daemon --timeout 8h &
+
+Requests for hosts other than CodeCommit are ignored so that git moves on to
+the next configured helper, or are passed to the --fallback helper:
+
+git config --global credential.helper '!codecommit credential-helper --fallback store $@'
+
+%s
+`, gitCredentialsHelperAPIDoc, identityPrecedenceDoc),
+		RunE:      c.executeCredentialHelper,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"get", "store", "erase"},
 	}
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	addCacheFlag(cmd)
+	addClockSkewFlag(cmd)
+	addDaemonSocketFlag(cmd)
+	cmd.Flags().String("fallback", os.Getenv(envKeyCodeCommitCredentialFallback),
+		fmt.Sprintf(`credential helper for hosts other than CodeCommit, eg. "store" or "cache"
+Can be set from the environment with %s`, envKeyCodeCommitCredentialFallback))
 	return cmd
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -32,3 +33,70 @@ type CodeCommitCredentialsTest struct {
 	t     *testing.T
 	topts TestOptions
 }
+
+// TestParseGitRequest tests parsing of the git credential protocol, stopping at the terminating blank line.
+func TestParseGitRequest(t *testing.T) {
+	input := `protocol=https
+host=git-codecommit.us-east-1.amazonaws.com
+path=v1/repos/your-repo
+username=user
+capability[]=authtype
+capability[]=state
+wwwauth[]=Basic realm="codecommit"
+unknown=ignored
+
+protocol=http
+`
+	r, err := parseGitRequest(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse request, err=%v", err)
+	}
+	expected := "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo"
+	if actual := r.url(); actual != expected {
+		t.Errorf("Expected url %q, actual %q", expected, actual)
+	}
+	if r.username != "user" {
+		t.Errorf("Expected username %q, actual %q", "user", r.username)
+	}
+	if len(r.capability) != 2 || r.capability[0] != "authtype" || r.capability[1] != "state" {
+		t.Errorf("Unexpected capabilities %v", r.capability)
+	}
+	if len(r.wwwauth) != 1 || r.wwwauth[0] != `Basic realm="codecommit"` {
+		t.Errorf("Unexpected wwwauth %v", r.wwwauth)
+	}
+}
+
+// TestParseGitRequestURL tests that the url attribute sets its components, and later attributes override them.
+func TestParseGitRequestURL(t *testing.T) {
+	input := `url=https://user@git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo
+path=v1/repos/other-repo
+`
+	r, err := parseGitRequest(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("Failed to parse request, err=%v", err)
+	}
+	expected := "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/other-repo"
+	if actual := r.url(); actual != expected {
+		t.Errorf("Expected url %q, actual %q", expected, actual)
+	}
+	if r.username != "user" {
+		t.Errorf("Expected username %q, actual %q", "user", r.username)
+	}
+}
+
+// TestParseGitRequestInvalid tests that lines which are not attributes are rejected.
+func TestParseGitRequestInvalid(t *testing.T) {
+	if _, err := parseGitRequest(strings.NewReader("protocol\n")); err == nil {
+		t.Errorf("expected error not returned")
+	}
+}
+
+// TestEmitHelperCredsNoPath tests that requests without a path ask for credential.useHttpPath.
+func TestEmitHelperCredsNoPath(t *testing.T) {
+	c := &CodeCommitCredentials{}
+	r := GitRequest{protocol: "https", host: "git-codecommit.us-east-1.amazonaws.com"}
+	err := c.emitHelperCreds(newCredentialHelperCmd().Flags(), r)
+	if err == nil || !strings.Contains(err.Error(), "credential.https://git-codecommit.us-east-1.amazonaws.com.useHttpPath") {
+		t.Errorf("Expected useHttpPath error, actual %v", err)
+	}
+}
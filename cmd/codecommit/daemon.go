@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/cobra"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const (
+	envKeyCodeCommitDaemonSocket = "CODECOMMIT_DAEMON_SOCKET"
+
+	daemonSocketName = "daemon.sock"
+
+	daemonActionGet   = "get"
+	daemonActionErase = "erase"
+	daemonActionExit  = "exit"
+
+	//daemonTimeout is how long the helper waits for the daemon to answer
+	daemonTimeout = 30 * time.Second
+)
+
+//daemonSDKEnv are the AWS SDK environment variables which set the identity of
+//the helper, requests from helpers with any of them set are not sent to the daemon.
+var daemonSDKEnv = []string{
+	envKeyAwsAccessKeyID,
+	"AWS_ACCESS_KEY",
+	"AWS_SECRET_ACCESS_KEY",
+	"AWS_SECRET_KEY",
+	"AWS_SESSION_TOKEN",
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+	"AWS_ROLE_ARN",
+	"AWS_ROLE_SESSION_NAME",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN",
+	"AWS_SHARED_CREDENTIALS_FILE",
+	envKeyAwsConfigFile,
+	"AWS_SDK_LOAD_CONFIG",
+}
+
+//daemonRole is the wire form of an assumeRole
+type daemonRole struct {
+	ARN            string
+	SessionName    string
+	ExternalID     string
+	Duration       time.Duration
+	Tags           []*sts.Tag
+	SourceIdentity string
+}
+
+//daemonRequest is sent by the credential helper to the daemon, one per connection
+type daemonRequest struct {
+	Action string
+	URL    string
+	//Profile, Region and Roles are the identity the credentials are retrieved with
+	Profile          string
+	Region           string
+	Roles            []daemonRole
+	CorrectClockSkew bool
+}
+
+//key return the key of the request's identity, whose session the daemon keeps
+func (r *daemonRequest) key() string {
+	b, _ := json.Marshal([]interface{}{r.Profile, r.Region, r.Roles})
+	return string(b)
+}
+
+//daemonResponse is the daemon's answer to a daemonRequest
+type daemonResponse struct {
+	Credentials *codecommit.CodeCommitCredentials
+	//ErrorCode is the AWS error code, if any, of Error
+	ErrorCode string
+	Error     string
+}
+
+//daemonSocketPath return the default path of the daemon's socket, in the credential cache directory
+func daemonSocketPath() string {
+	if path := os.Getenv(envKeyCodeCommitDaemonSocket); path != "" {
+		return path
+	}
+	dir := os.Getenv(envKeyCodeCommitCacheDir)
+	if dir == "" {
+		base, err := os.UserCacheDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(base, cacheDirName)
+	}
+	return filepath.Join(dir, daemonSocketName)
+}
+
+//CredentialDaemon keeps the AWS credentials of the identities credential
+//helpers request in memory, and signs CodeCommit passwords with them.
+type CredentialDaemon struct {
+	socket  string
+	timeout time.Duration
+
+	mu sync.Mutex
+	//sessions of each daemonRequest.key, with the credentials of the identity
+	sessions map[string]*session.Session
+	listener net.Listener
+	idle     *time.Timer
+	//requests being answered, which are finished before exiting
+	requests sync.WaitGroup
+}
+
+func (d *CredentialDaemon) execute(cmd *cobra.Command, args []string) error {
+	f := cmd.Flags()
+	var err error
+	if d.socket, err = f.GetString("socket"); err != nil {
+		return err
+	}
+	if d.socket == "" {
+		return fmt.Errorf("no daemon socket, set --socket or %s", envKeyCodeCommitDaemonSocket)
+	}
+	if d.timeout, err = f.GetDuration("timeout"); err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		if args[0] != daemonActionExit {
+			return fmt.Errorf("unsupported action %q", args[0])
+		}
+		_, err := callDaemon(d.socket, &daemonRequest{Action: daemonActionExit})
+		return err
+	}
+	if err := d.listen(); err != nil {
+		return err
+	}
+	return d.serve()
+}
+
+//listen creates the daemon's socket, replacing that of a daemon which is no longer running
+func (d *CredentialDaemon) listen() error {
+	if err := os.MkdirAll(filepath.Dir(d.socket), 0700); err != nil {
+		return err
+	}
+	if conn, err := net.Dial("unix", d.socket); err == nil {
+		conn.Close()
+		return fmt.Errorf("a credential daemon is already listening on %s", d.socket)
+	}
+	if err := os.Remove(d.socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// the socket is created in a private directory and moved into place once
+	// only the owner can connect, its directory may be accessible by others
+	dir, err := ioutil.TempDir(filepath.Dir(d.socket), ".daemon-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, daemonSocketName)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return err
+	}
+	// serve removes the socket from its final path
+	l.SetUnlinkOnClose(false)
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return err
+	}
+	if err := os.Rename(path, d.socket); err != nil {
+		l.Close()
+		return err
+	}
+	d.listener = l
+	d.sessions = map[string]*session.Session{}
+	return nil
+}
+
+//serve answers requests until the exit action, or until no request is received for the idle timeout
+func (d *CredentialDaemon) serve() error {
+	defer os.Remove(d.socket)
+	if d.timeout > 0 {
+		d.idle = time.AfterFunc(d.timeout, func() { d.listener.Close() })
+	}
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			// the listener is closed on exit and idle timeout
+			d.requests.Wait()
+			return nil
+		}
+		if d.idle != nil {
+			d.idle.Reset(d.timeout)
+		}
+		d.requests.Add(1)
+		go d.handle(conn)
+	}
+}
+
+func (d *CredentialDaemon) handle(conn net.Conn) {
+	defer d.requests.Done()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(daemonTimeout))
+
+	req := &daemonRequest{}
+	resp := &daemonResponse{}
+	if err := json.NewDecoder(conn).Decode(req); err != nil {
+		resp.Error = fmt.Sprintf("invalid request: %v", err)
+	} else if err := d.answer(req, resp); err != nil {
+		resp.Error = err.Error()
+		if aerr, ok := err.(awserr.Error); ok {
+			resp.ErrorCode, resp.Error = aerr.Code(), aerr.Message()
+		}
+	}
+	json.NewEncoder(conn).Encode(resp)
+
+	if req.Action == daemonActionExit {
+		d.listener.Close()
+	}
+}
+
+func (d *CredentialDaemon) answer(req *daemonRequest, resp *daemonResponse) error {
+	switch req.Action {
+	case daemonActionGet:
+		creds, err := d.sign(req)
+		if err != nil {
+			// do not keep credentials which failed, eg. a role which could not be assumed
+			d.forget(req.key())
+			return err
+		}
+		resp.Credentials = creds
+	case daemonActionErase:
+		d.forget(req.key())
+	case daemonActionExit:
+	default:
+		return fmt.Errorf("unsupported action %q", req.Action)
+	}
+	return nil
+}
+
+//sign return CodeCommit credentials for the request's URL, signed with the
+//credentials of its identity, which are kept and refreshed as they expire.
+func (d *CredentialDaemon) sign(req *daemonRequest) (*codecommit.CodeCommitCredentials, error) {
+	sess, err := d.session(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var options []func(*codecommit.CloneURL)
+	if req.CorrectClockSkew {
+		options = append(options, codecommit.WithSkewCorrection(nil))
+	}
+	cloneURL, err := codecommit.NewCloneURL(sess, req.URL, options...)
+	if err != nil {
+		return nil, err
+	}
+	return cloneURL.GetCodeCommitCredentials()
+}
+
+//session return the session of the request's identity
+func (d *CredentialDaemon) session(req *daemonRequest) (*session.Session, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if sess, ok := d.sessions[req.key()]; ok {
+		return sess, nil
+	}
+
+	// the profile is always that of the helper, never the daemon's own AWS_PROFILE
+	profile := req.Profile
+	if profile == "" {
+		profile = "default"
+	}
+	sess, err := newSession(&aws.Config{Region: aws.String(req.Region)}, profile, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(req.Roles) > 0 {
+		roles := make(roleChain, len(req.Roles))
+		for i, r := range req.Roles {
+			roles[i] = &assumeRole{
+				arn:            r.ARN,
+				sessionName:    r.SessionName,
+				externalID:     r.ExternalID,
+				duration:       r.Duration,
+				tags:           r.Tags,
+				sourceIdentity: r.SourceIdentity,
+			}
+		}
+		creds, err := roles.credentials(sess, nil, "")
+		if err != nil {
+			return nil, err
+		}
+		sess.Config.Credentials = creds
+	}
+	d.sessions[req.key()] = sess
+	return sess, nil
+}
+
+func (d *CredentialDaemon) forget(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.sessions, key)
+}
+
+//callDaemon sends req to the daemon listening on socket and return its response
+func callDaemon(socket string, req *daemonRequest) (*daemonResponse, error) {
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(daemonTimeout))
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	}
+	resp := &daemonResponse{}
+	if err := json.NewDecoder(conn).Decode(resp); err != nil {
+		return nil, err
+	}
+	if resp.ErrorCode != "" {
+		return nil, awserr.New(resp.ErrorCode, resp.Error, nil)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("%s", resp.Error)
+	}
+	return resp, nil
+}
+
+//daemonRequest return the request for the daemon to sign url with the helper's
+//identity, nil if the identity can not be used by the daemon: MFA codes
+//must be prompted for by the helper, and the credentials, web identity tokens
+//and AWS config files of the helper's environment are not in the daemon's.
+func (c *CodeCommitCredentials) daemonRequest(action, url string) *daemonRequest {
+	for _, key := range daemonSDKEnv {
+		if os.Getenv(key) != "" {
+			return nil
+		}
+	}
+	req := &daemonRequest{Action: action, URL: url, Profile: helperProfile(c.profile), Region: aws.StringValue(c.region)}
+	for _, r := range c.roles {
+		if r.mfaSerial != "" || r.webIdentity != nil {
+			return nil
+		}
+		req.Roles = append(req.Roles, daemonRole{
+			ARN:            r.arn,
+			SessionName:    r.sessionName,
+			ExternalID:     r.externalID,
+			Duration:       r.duration,
+			Tags:           r.tags,
+			SourceIdentity: r.sourceIdentity,
+		})
+	}
+	return req
+}
+
+//helperProfile return profile, or the default profile of the helper's
+//environment if it is empty, so that the daemon does not use its own.
+func helperProfile(profile string) string {
+	if profile == "" {
+		profile = os.Getenv(envKeyAwsDefaultProfile)
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	return profile
+}
+
+func newCredentialDaemonCmd() *cobra.Command {
+	d := &CredentialDaemon{}
+	cmd := &cobra.Command{
+		Use:   "credential-daemon [exit]",
+		Short: "Keep AWS credentials in memory for credential-helper",
+		Long: fmt.Sprintf(`Keep AWS credentials in memory for credential-helper, like git-credential-cache--daemon
+
+The daemon listens on a unix socket only accessible by the user, credential-helper
+sends its requests to the daemon when it is running, and otherwise signs them
+itself. The daemon keeps the session of each profile and role chain requested,
+refreshing the credentials before they expire, and exits when no request is
+received for --timeout, or when run with "exit".
+
+Requests use the profile of the helper, the default profile if it has none,
+and the profile's credentials are read by the daemon. Requests for roles
+requiring MFA or a web identity token, or from a helper with AWS credentials or
+config files set in its environment, eg. AWS_ACCESS_KEY_ID or AWS_CONFIG_FILE,
+are signed by the helper.
+
+Example usage:
+
+codecommit credential-daemon --timeout 8h &
+codecommit credential-daemon exit
+
+The socket defaults to %s in the credential cache directory.
+`, daemonSocketName),
+		RunE: d.execute,
+		Args: cobra.RangeArgs(0, 1),
+	}
+	addDaemonSocketFlag(cmd)
+	cmd.Flags().Duration("timeout", 15*time.Minute, "exit when no request is received for this long, 0 to never exit")
+	return cmd
+}
+
+//addDaemonSocketFlag adds the --socket flag to cmd
+func addDaemonSocketFlag(cmd *cobra.Command) {
+	cmd.Flags().String("socket", daemonSocketPath(),
+		fmt.Sprintf("the credential daemon's unix socket\nCan be set from the environment with %s",
+			envKeyCodeCommitDaemonSocket))
+}
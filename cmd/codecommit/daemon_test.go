@@ -0,0 +1,147 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+func startTestDaemon(t *testing.T, timeout time.Duration) (*CredentialDaemon, chan error, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "TestCredentialDaemon-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	d := &CredentialDaemon{socket: filepath.Join(dir, daemonSocketName), timeout: timeout}
+	if err := d.listen(); err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("Failed to listen, err=%v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- d.serve() }()
+	return d, done, func() { os.RemoveAll(dir) }
+}
+
+// TestCredentialDaemon tests that the daemon signs requests and exits on request.
+func TestCredentialDaemon(t *testing.T) {
+	d, done, cleanup := startTestDaemon(t, time.Minute)
+	defer cleanup()
+
+	// the daemon reads the credentials of the requested profile, not its own AWS_PROFILE
+	credentialsFile := filepath.Join(filepath.Dir(d.socket), "credentials")
+	if err := ioutil.WriteFile(credentialsFile, []byte(`[default]
+aws_access_key_id = AKIDDAEMON
+aws_secret_access_key = SECRET
+`), 0600); err != nil {
+		t.Fatalf("Failed to write credentials, err=%v", err)
+	}
+	for key, value := range map[string]string{
+		"AWS_SHARED_CREDENTIALS_FILE": credentialsFile,
+		envKeyAwsConfigFile:           os.DevNull,
+		envKeyAwsProfile:              "daemon",
+	} {
+		os.Setenv(key, value)
+		defer os.Unsetenv(key)
+	}
+
+	fi, err := os.Stat(d.socket)
+	if err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Expected a socket only the owner can connect to, actual %v, err=%v", fi, err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(filepath.Dir(d.socket), ".daemon-*")); len(matches) > 0 {
+		t.Errorf("Expected the socket's private directory to be removed, actual %v", matches)
+	}
+
+	if err := (&CredentialDaemon{socket: d.socket}).listen(); err == nil {
+		t.Errorf("Expected error for a second daemon on the same socket")
+	}
+
+	req := &daemonRequest{
+		Action: daemonActionGet,
+		URL:    "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo",
+		Region: "us-east-1",
+	}
+	resp, err := callDaemon(d.socket, req)
+	if err != nil {
+		t.Fatalf("Failed to get credentials, err=%v", err)
+	}
+	if resp.Credentials == nil || resp.Credentials.Username != "AKIDDAEMON" || resp.Credentials.Password == "" {
+		t.Errorf("Unexpected credentials %+v", resp.Credentials)
+	}
+	if len(d.sessions) != 1 {
+		t.Errorf("Expected the session to be kept, actual %d sessions", len(d.sessions))
+	}
+
+	if _, err := callDaemon(d.socket, &daemonRequest{Action: daemonActionErase, Region: "us-east-1"}); err != nil {
+		t.Errorf("Failed to erase credentials, err=%v", err)
+	}
+	if len(d.sessions) != 0 {
+		t.Errorf("Expected the session to be erased, actual %d sessions", len(d.sessions))
+	}
+	if _, err := callDaemon(d.socket, &daemonRequest{Action: "unknown"}); err == nil {
+		t.Errorf("Expected error for unsupported action")
+	}
+
+	if _, err := callDaemon(d.socket, &daemonRequest{Action: daemonActionExit}); err != nil {
+		t.Errorf("Failed to exit, err=%v", err)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Daemon did not exit")
+	}
+	if _, err := os.Stat(d.socket); !os.IsNotExist(err) {
+		t.Errorf("Expected socket to be removed, err=%v", err)
+	}
+}
+
+// TestCredentialDaemonIdle tests that the daemon exits when idle.
+func TestCredentialDaemonIdle(t *testing.T) {
+	_, done, cleanup := startTestDaemon(t, 50*time.Millisecond)
+	defer cleanup()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Daemon did not exit when idle")
+	}
+}
+
+// TestDaemonRequest tests that identities the daemon can not sign for are signed by the helper.
+func TestDaemonRequest(t *testing.T) {
+	os.Unsetenv(envKeyAwsAccessKeyID)
+	os.Unsetenv(envKeyAwsConfigFile)
+	c := &CodeCommitCredentials{
+		profile: "dev",
+		region:  aws.String("us-east-1"),
+		roles:   roleChain{{arn: "arn:aws:iam::123456789012:role/git", sessionName: "me"}},
+	}
+	req := c.daemonRequest(daemonActionGet, "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo")
+	if req == nil || req.Profile != "dev" || len(req.Roles) != 1 || req.Roles[0].SessionName != "me" {
+		t.Errorf("Unexpected request %+v", req)
+	}
+
+	c.profile = ""
+	os.Setenv(envKeyAwsDefaultProfile, "team")
+	defer os.Unsetenv(envKeyAwsDefaultProfile)
+	if req := c.daemonRequest(daemonActionGet, ""); req == nil || req.Profile != "team" {
+		t.Errorf("Expected the helper's default profile, actual %+v", req)
+	}
+
+	for _, key := range []string{"AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_SESSION_TOKEN", "AWS_CONTAINER_CREDENTIALS_FULL_URI"} {
+		os.Setenv(key, "set")
+		if req := c.daemonRequest(daemonActionGet, ""); req != nil {
+			t.Errorf("Expected no daemon request with %s set, actual %+v", key, req)
+		}
+		os.Unsetenv(key)
+	}
+
+	c.roles[0].mfaSerial = "arn:aws:iam::123456789012:mfa/me"
+	if req := c.daemonRequest(daemonActionGet, ""); req != nil {
+		t.Errorf("Expected no daemon request for a role requiring MFA, actual %+v", req)
+	}
+}
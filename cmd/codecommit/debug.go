@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const redacted = "<redacted>"
+
+//DebugSignature prints how CodeCommit passwords are signed for a repository
+type DebugSignature struct {
+	CodeCommitCredentials
+}
+
+func (d *DebugSignature) execute(cmd *cobra.Command, args []string) error {
+	f := cmd.Flags()
+
+	username, err := f.GetString("username")
+	if err != nil {
+		return err
+	}
+	passwordStdin, err := f.GetBool("password-stdin")
+	if err != nil {
+		return err
+	}
+	var password string
+	if passwordStdin {
+		if password, err = readPassword(os.Stdin); err != nil {
+			return err
+		}
+	}
+
+	url, err := d.configure(f)
+	if err != nil {
+		return err
+	}
+	cloneURL, err := d.cloneURL(url)
+	if err != nil {
+		return d.describeError(err)
+	}
+	ctx, err := cloneURL.SigningContext()
+	if err != nil {
+		return err
+	}
+	printSigningContext(os.Stdout, url, ctx)
+
+	if password == "" {
+		return nil
+	}
+	if username == "" {
+		username = ctx.CredValues.AccessKeyID
+		if ctx.CredValues.SessionToken != "" {
+			username += "%" + ctx.CredValues.SessionToken
+		}
+	}
+	if err := checkAccessKeyID(username, ctx.CredValues.AccessKeyID); err != nil {
+		return fmt.Errorf("password verification failed, %v", err)
+	}
+	if err := codecommit.VerifyCodeCommitPassword(url, username, password, ctx.CredValues.SecretAccessKey); err != nil {
+		return fmt.Errorf("password verification failed, %v", err)
+	}
+	fmt.Fprintln(os.Stdout, "\nPassword verification: ok")
+	return nil
+}
+
+//readPassword return the first line of r, so that the password is not an argument other users can see
+func readPassword(r io.Reader) (string, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	password := strings.TrimSpace(line)
+	if password == "" {
+		return "", fmt.Errorf("no password on stdin")
+	}
+	return password, nil
+}
+
+//checkAccessKeyID return an error if username is not for the access key ID of
+//the current credentials, whose secret can not verify its password.
+func checkAccessKeyID(username, accessKeyID string) error {
+	if id := strings.SplitN(username, "%", 2)[0]; id != accessKeyID {
+		return &codecommit.VerificationError{Component: "username", Message: fmt.Sprintf(
+			"access key ID %s is not that of the current AWS credentials, %s, the password can not be verified",
+			id, accessKeyID)}
+	}
+	return nil
+}
+
+//printSigningContext writes the signing inputs of ctx to w. The session token
+//is redacted and neither the secret access key nor the signature are written.
+func printSigningContext(w io.Writer, url string, ctx *codecommit.SigningCtx) {
+	username := ctx.CredValues.AccessKeyID
+	if ctx.CredValues.SessionToken != "" {
+		username += "%" + redacted
+	}
+	fmt.Fprintf(w, "URL:          %s\n", url)
+	fmt.Fprintf(w, "Username:     %s\n", username)
+	fmt.Fprintf(w, "Credentials:  %s\n", ctx.CredValues.ProviderName)
+	fmt.Fprintf(w, "Signing time: %s\n", ctx.Time.UTC().Format("2006-01-02T15:04:05Z"))
+	fmt.Fprintf(w, "Scope:        %s\n", ctx.Scope())
+	fmt.Fprintf(w, "\nCanonical request:\n%s\n\n", indent(ctx.CanonicalRequest()))
+	fmt.Fprintf(w, "String to sign:\n%s\n", indent(ctx.StringToSign()))
+}
+
+//indent prefixes each line of s with a tab, so blank lines remain visible
+func indent(s string) string {
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	return "\t" + strings.Join(lines, "\n\t")
+}
+
+func newDebugSignatureCmd() *cobra.Command {
+	d := &DebugSignature{}
+	cmd := &cobra.Command{
+		Use:   "debug-signature [options]",
+		Short: "Print the signing inputs of CodeCommit credentials for URL",
+		Long: fmt.Sprintf(`Print the canonical request, credential scope and string to sign used to sign
+CodeCommit passwords for a repository, for troubleshooting rejected credentials.
+The session token is redacted and the secret key and signature are not printed.
+
+If --password-stdin is set, the password read from stdin, eg. one git reported as
+rejected, is verified against the current AWS credentials and the mismatching
+component is reported:
+
+echo "$PASSWORD" | codecommit debug-signature --url your-repo --username "$USERNAME" --password-stdin
+
+%s
+
+%s
+`, repositoryFormsDoc, identityPrecedenceDoc),
+		RunE: d.execute,
+		Args: cobra.ExactArgs(0),
+	}
+
+	cmd.Flags().String("url", os.Getenv(envKeyCodeCommitURL),
+		fmt.Sprintf("the repository URL, ARN or name\nCan be set from the environment with %s",
+			envKeyCodeCommitURL))
+	addRegionFlag(cmd)
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	cmd.Flags().String("username", "", "username to verify the password with, defaults to that of the current credentials")
+	cmd.Flags().Bool("password-stdin", false, "read the password to verify with the current credentials from stdin")
+	addCacheFlag(cmd)
+	addClockSkewFlag(cmd)
+	return cmd
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+// TestPrintSigningContext tests that the signing inputs are printed without secrets.
+func TestPrintSigningContext(t *testing.T) {
+	rawURL := "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/repo"
+	u, _ := url.Parse(rawURL)
+	creds := credentials.Value{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}
+	signTime := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	ctx := codecommit.NewSigningContext(u, "us-east-1", endpoints.CodecommitServiceID, creds, signTime)
+
+	var out bytes.Buffer
+	printSigningContext(&out, rawURL, &ctx)
+	actual := out.String()
+
+	for _, secret := range []string{"SECRET", "TOKEN"} {
+		if strings.Contains(actual, secret) {
+			t.Errorf("Output contains %q:\n%s", secret, actual)
+		}
+	}
+	for _, expected := range []string{"AKID%" + redacted, "20060102/us-east-1/codecommit/aws4_request", "\thost:git-codecommit.us-east-1.amazonaws.com\n"} {
+		if !strings.Contains(actual, expected) {
+			t.Errorf("Output does not contain %q:\n%s", expected, actual)
+		}
+	}
+}
+
+// TestCheckAccessKeyID tests that a username for other credentials is reported rather than a signature mismatch.
+func TestCheckAccessKeyID(t *testing.T) {
+	if err := checkAccessKeyID("AKID%TOKEN", "AKID"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	err := checkAccessKeyID("OTHER%TOKEN", "AKID")
+	if e, ok := err.(*codecommit.VerificationError); !ok || e.Component != "username" {
+		t.Errorf("Expected username mismatch, actual %v", err)
+	}
+
+	if password, err := readPassword(strings.NewReader("20060102T150405Zsig\n")); err != nil || password != "20060102T150405Zsig" {
+		t.Errorf("Unexpected password %q, err=%v", password, err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+//credentialSource describes where AWS credentials are looked up for profile
+func credentialSource(profile string) string {
+	if profile != "" {
+		return fmt.Sprintf("profile %q", profile)
+	}
+	return "the environment, shared credentials file or instance role"
+}
+
+//describeError return an actionable error for err, which occurred retrieving
+//CodeCommit credentials using profile and, if not empty, assuming roleARN.
+func describeError(err error, profile, roleARN string) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok {
+		return err
+	}
+
+	source := credentialSource(profile)
+	switch aerr.Code() {
+	case "NoCredentialProviders", "EnvAccessKeyNotFound", "SharedCredsLoad":
+		return fmt.Errorf("no AWS credentials found via %s, configure credentials or set --profile or %s",
+			source, envKeyAwsProfile)
+	case "SharedConfigProfileNotExistsError":
+		return fmt.Errorf("AWS profile %q not found in the shared config or credentials file", profile)
+	case "ExpiredToken", "ExpiredTokenException", "RequestExpired":
+		return fmt.Errorf("AWS credentials found via %s have expired, refresh them and retry: %s",
+			source, aerr.Message())
+	case "InvalidClientTokenId", "SignatureDoesNotMatch", "UnrecognizedClientException":
+		return fmt.Errorf("AWS credentials found via %s were rejected: %s", source, aerr.Message())
+	case "AccessDenied":
+		if roleARN != "" {
+			return fmt.Errorf("AssumeRole denied for %s using credentials found via %s: %s",
+				roleARN, source, aerr.Message())
+		}
+	case ssoErrCodeTokenExpired:
+		return fmt.Errorf("%s", aerr.Message())
+	case request.ErrCodeRequestError, request.ErrCodeResponseTimeout:
+		return fmt.Errorf("unable to reach AWS to retrieve credentials, check network access: %v", err)
+	}
+	return err
+}
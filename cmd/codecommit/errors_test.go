@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// TestDescribeError tests that AWS errors are described with the profile and role they occurred for.
+func TestDescribeError(t *testing.T) {
+	roleARN := "arn:aws:iam::123456789012:role/test"
+	tests := []struct {
+		err      error
+		profile  string
+		roleARN  string
+		expected string
+	}{
+		{credentials.ErrNoValidProvidersFoundInChain, "dev", "", `no AWS credentials found via profile "dev"`},
+		{credentials.ErrNoValidProvidersFoundInChain, "", "", "no AWS credentials found via the environment"},
+		{awserr.New("AccessDenied", "not authorized", nil), "", roleARN, "AssumeRole denied for " + roleARN},
+		{awserr.New("ExpiredToken", "expired", nil), "dev", "", `profile "dev" have expired`},
+		{errors.New("other"), "", "", "other"},
+	}
+	for _, test := range tests {
+		actual := describeError(test.err, test.profile, test.roleARN).Error()
+		if !strings.Contains(actual, test.expected) {
+			t.Errorf("expected error containing %q, actual %q", test.expected, actual)
+		}
+	}
+}
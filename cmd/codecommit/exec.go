@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	envKeyGitConfigCount = "GIT_CONFIG_COUNT"
+
+	//execCredentialContext is the credential config context of regional CodeCommit hosts
+	execCredentialContext = "https://git-codecommit.*.amazonaws.com"
+)
+
+//execPartitionRegions are the regions roles are assumed in when none is set, by partition
+var execPartitionRegions = map[string]string{"aws": "us-east-1", "aws-cn": "cn-north-1", "aws-us-gov": "us-gov-west-1"}
+
+//execOwnFlags are the flags of the exec command which are not passed on to credential-helper
+var execOwnFlags = map[string]bool{"url": true, "region": true}
+
+//Exec runs a command with git configured to use credential-helper for
+//CodeCommit, through the environment of the command only.
+type Exec struct{}
+
+//helperArgs return the credential-helper arguments for the flags set on the command line
+func helperArgs(f *pflag.FlagSet) []string {
+	args := []string{"credential-helper"}
+	f.Visit(func(flag *pflag.Flag) {
+		if execOwnFlags[flag.Name] {
+			return
+		}
+		if sv, ok := flag.Value.(pflag.SliceValue); ok {
+			for _, v := range sv.GetSlice() {
+				args = append(args, "--"+flag.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "--"+flag.Name+"="+flag.Value.String())
+	})
+	return args
+}
+
+//helperCommand return the credential.helper value running the executable with args
+func helperCommand(executable string, args []string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, shellQuote(executable))
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return "!" + strings.Join(quoted, " ")
+}
+
+//gitConfigEnv return the environment variables adding config, key/value pairs,
+//to the git config of processes after the pairs already set in env.
+func gitConfigEnv(env []string, config [][2]string) ([]string, error) {
+	count := 0
+	for _, kv := range env {
+		if strings.HasPrefix(kv, envKeyGitConfigCount+"=") {
+			n, err := strconv.Atoi(strings.TrimPrefix(kv, envKeyGitConfigCount+"="))
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s in the environment: %q", envKeyGitConfigCount, kv)
+			}
+			count = n
+		}
+	}
+	vars := make([]string, 0, 2*len(config)+1)
+	for i, kv := range config {
+		vars = append(vars,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count+i, kv[0]),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count+i, kv[1]))
+	}
+	return append(vars, fmt.Sprintf("%s=%d", envKeyGitConfigCount, count+len(config))), nil
+}
+
+//credentialConfig return the git config using helper for the credential
+//contexts, the regional CodeCommit hosts and those of urls. Other helpers
+//are reset so that credentials stored for CodeCommit are not used.
+func credentialConfig(helper string, urls []string) [][2]string {
+	contexts := []string{execCredentialContext}
+	seen := map[string]bool{execCredentialContext: true}
+	for _, url := range urls {
+		var r GitRequest
+		if err := r.setURL(url); err != nil {
+			continue
+		}
+		context := r.protocol + "://" + r.host
+		if !seen[context] {
+			seen[context] = true
+			contexts = append(contexts, context)
+		}
+	}
+
+	var config [][2]string
+	for _, context := range contexts {
+		config = append(config,
+			[2]string{"credential." + context + ".helper", ""},
+			[2]string{"credential." + context + ".helper", helper},
+			[2]string{"credential." + context + ".useHttpPath", "true"})
+	}
+	return config
+}
+
+//prewarm retrieves the credentials of the repositories refs, caching role
+//sessions if enabled and prompting for MFA codes before the command runs.
+//Without repositories the role chain is assumed once, which caches the session
+//of a role requiring MFA, or else the credentials of the profile are checked.
+func (e *Exec) prewarm(f *pflag.FlagSet, refs []string) ([]string, error) {
+	if len(refs) == 0 {
+		return nil, e.prewarmIdentity(f)
+	}
+
+	var urls []string
+	restore := saveFlags(f)
+	for _, ref := range refs {
+		c := &CodeCommitCredentials{}
+		url, err := c.configureRepository(f, ref)
+		restore()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := c.getCreds(url); err != nil {
+			return nil, fmt.Errorf("%s: %v", url, c.describeError(err))
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+//prewarmIdentity retrieves the credentials of the profile and role chain flags
+func (e *Exec) prewarmIdentity(f *pflag.FlagSet) error {
+	c := &CodeCommitCredentials{}
+	var err error
+	if c.profile, err = f.GetString("profile"); err != nil {
+		return err
+	}
+	if c.roles, err = parseRoleChain(f); err != nil {
+		return err
+	}
+	region, err := f.GetString("region")
+	if err != nil {
+		return err
+	}
+	if region == "" {
+		region = configRegion(c.profile)
+	}
+	if region == "" && len(c.roles) > 0 {
+		// STS is global, any region of the partition of the first role will do
+		region = execPartitionRegions[strings.SplitN(c.roles[0].arn, ":", 3)[1]]
+	}
+	c.region = &region
+	// the scope of the helper is the repository, which is unknown, only the
+	// sessions of roles requiring MFA are cached
+	if err := c.setCache(f, ""); err != nil {
+		return err
+	}
+
+	sess, err := c.session()
+	if err != nil {
+		return err
+	}
+	if _, err := sess.Config.Credentials.Get(); err != nil {
+		return c.describeError(err)
+	}
+	return nil
+}
+
+func (e *Exec) execute(cmd *cobra.Command, args []string) error {
+	f := cmd.Flags()
+	// the identity set on the command line, before it is resolved for each repository
+	helper := helperArgs(f)
+
+	refs, err := f.GetStringSlice("url")
+	if err != nil {
+		return err
+	}
+	urls, err := e.prewarm(f, refs)
+	if err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	env, err := gitConfigEnv(os.Environ(), credentialConfig(helperCommand(executable, helper), urls))
+	if err != nil {
+		return err
+	}
+
+	return e.run(args, env)
+}
+
+//run runs the command with the extra environment variables env, its exit
+//status is passed on.
+func (e *Exec) run(args []string, env []string) error {
+	c := exec.Command(args[0], args[1:]...)
+	c.Env = append(os.Environ(), env...)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+
+	// the command receives interrupts from the terminal, wait for it to exit,
+	// and pass on terminations, eg. of a cancelled CI job
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+
+	if err := c.Start(); err != nil {
+		return err
+	}
+	go func() {
+		for sig := range signals {
+			if sig != os.Interrupt {
+				c.Process.Signal(sig)
+			}
+		}
+	}()
+	err := c.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
+
+func newExecCmd() *cobra.Command {
+	e := &Exec{}
+	cmd := &cobra.Command{
+		Use:   "exec [options] -- COMMAND [ARG...]",
+		Short: "Run a command with git credentials for CodeCommit, without changing the git config",
+		Long: fmt.Sprintf(`Run a command with git credentials for CodeCommit, without changing the git config
+
+Git run by the command, and its children, uses credential-helper for CodeCommit
+hosts, configured through %[1]s and GIT_CONFIG_KEY_n/GIT_CONFIG_VALUE_n
+environment variables, which require git 2.31 or later. Other credential helpers
+are not used for CodeCommit, and the global git config is not changed.
+
+The identity flags, eg. --profile and --role-arn, and --cache are passed on to
+credential-helper. With --cache role sessions are cached so that the command's git
+processes share them, the session of a role requiring MFA is always cached.
+
+The credentials of the repositories set with --url, or else of the profile and
+role chain, are retrieved before the command runs, so that errors and MFA prompts
+happen first. The command's exit status is passed on, and SIGTERM to the command.
+
+Example usage:
+
+codecommit exec --role-arn arn:aws:iam::123456789012:role/git -- terraform init
+codecommit exec --url your-repo --region us-east-1 -- go mod download
+
+%[2]s
+`, envKeyGitConfigCount, identityPrecedenceDoc),
+		RunE: e.execute,
+		Args: cobra.MinimumNArgs(1),
+	}
+	// flags after the command are its own
+	cmd.Flags().SetInterspersed(false)
+
+	cmd.Flags().StringSlice("url", envList(envKeyCodeCommitURL),
+		fmt.Sprintf(`repository URL, ARN or name whose credentials are retrieved before the command runs, may be repeated
+Can be set from the environment with %s`, envKeyCodeCommitURL))
+	addRegionFlag(cmd)
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	addCacheFlag(cmd)
+	addClockSkewFlag(cmd)
+	return cmd
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// TestGitConfigEnv tests that config is added after the pairs already in the environment.
+func TestGitConfigEnv(t *testing.T) {
+	config := [][2]string{{"credential.helper", ""}, {"credential.useHttpPath", "true"}}
+	env, err := gitConfigEnv([]string{"HOME=/home/me", "GIT_CONFIG_COUNT=1"}, config)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	expected := []string{
+		"GIT_CONFIG_KEY_1=credential.helper", "GIT_CONFIG_VALUE_1=",
+		"GIT_CONFIG_KEY_2=credential.useHttpPath", "GIT_CONFIG_VALUE_2=true",
+		"GIT_CONFIG_COUNT=3",
+	}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("Expected %q, actual %q", expected, env)
+	}
+
+	if _, err := gitConfigEnv([]string{"GIT_CONFIG_COUNT=x"}, config); err == nil {
+		t.Errorf("Expected error for an invalid GIT_CONFIG_COUNT")
+	}
+}
+
+// TestHelperArgs tests that the identity flags set on the command line are passed on to credential-helper.
+func TestHelperArgs(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringSlice("url", nil, "")
+	addRegionFlag(cmd)
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	addCacheFlag(cmd)
+	if err := cmd.Flags().Parse([]string{"--url", "your-repo", "--region", "us-east-1", "--profile", "dev",
+		"--role-arn", "arn:aws:iam::123456789012:role/a", "--role-arn", "arn:aws:iam::123456789012:role/b"}); err != nil {
+		t.Fatalf("Failed to parse flags, err=%v", err)
+	}
+
+	expected := []string{"credential-helper", "--profile=dev",
+		"--role-arn=arn:aws:iam::123456789012:role/a", "--role-arn=arn:aws:iam::123456789012:role/b"}
+	if actual := helperArgs(cmd.Flags()); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %q, actual %q", expected, actual)
+	}
+
+	if err := cmd.Flags().Parse([]string{"--cache"}); err != nil {
+		t.Fatalf("Failed to parse flags, err=%v", err)
+	}
+	expected = []string{"credential-helper", "--cache=true", "--profile=dev",
+		"--role-arn=arn:aws:iam::123456789012:role/a", "--role-arn=arn:aws:iam::123456789012:role/b"}
+	if actual := helperArgs(cmd.Flags()); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %q, actual %q", expected, actual)
+	}
+
+	expectedCommand := `!'/usr/bin/code commit' 'credential-helper' '--profile=it'\''s'`
+	if actual := helperCommand("/usr/bin/code commit", []string{"credential-helper", "--profile=it's"}); actual != expectedCommand {
+		t.Errorf("Expected %s, actual %s", expectedCommand, actual)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	envKeyCodeCommitCredentialFallback = "CODECOMMIT_CREDENTIAL_FALLBACK"
+)
+
+//fallbackHelperCommand return the shell command line for a credential helper,
+//interpreted as git interprets the credential.helper setting.
+//See https://git-scm.com/docs/gitcredentials#_custom_helpers
+func fallbackHelperCommand(helper string) string {
+	switch {
+	case strings.HasPrefix(helper, "!"):
+		return helper[1:]
+	case filepath.IsAbs(helper):
+		return helper
+	default:
+		return "git credential-" + helper
+	}
+}
+
+//runFallbackHelper runs the credential helper for op with request r, the
+//helper's output is passed through to stdout.
+func runFallbackHelper(helper, op string, r GitRequest, stdout, stderr io.Writer) error {
+	var stdin bytes.Buffer
+	if err := r.write(&stdin); err != nil {
+		return err
+	}
+
+	command := fallbackHelperCommand(helper)
+	cmd := exec.Command("sh", "-c", command+` "$@"`, command, op)
+	cmd.Stdin = &stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
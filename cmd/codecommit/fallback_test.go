@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestRunFallbackHelper tests that the request is passed to the fallback helper with the operation.
+func TestRunFallbackHelper(t *testing.T) {
+	r := GitRequest{
+		protocol:   "https",
+		host:       "github.com",
+		path:       "org/repo",
+		capability: []string{"authtype"},
+		extra:      []string{"password_expiry_utc=1136214245"},
+	}
+	var stdout, stderr strings.Builder
+	err := runFallbackHelper(`!f() { echo "op=$1"; cat; }; f`, "get", r, &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("Failed to run fallback helper, err=%v, stderr=%s", err, stderr.String())
+	}
+	expected := `op=get
+protocol=https
+host=github.com
+path=org/repo
+capability[]=authtype
+password_expiry_utc=1136214245
+
+`
+	if actual := stdout.String(); actual != expected {
+		t.Errorf("Expected output %q, actual %q", expected, actual)
+	}
+}
+
+// TestFallbackHelperCommand tests that helper names are interpreted as git does.
+func TestFallbackHelperCommand(t *testing.T) {
+	tests := map[string]string{
+		"store":               "git credential-store",
+		"/usr/bin/helper":     "/usr/bin/helper",
+		"!aws codecommit foo": "aws codecommit foo",
+	}
+	for helper, expected := range tests {
+		if actual := fallbackHelperCommand(helper); actual != expected {
+			t.Errorf("Expected command %q for %q, actual %q", expected, helper, actual)
+		}
+	}
+}
@@ -7,7 +7,6 @@ import (
 	"path/filepath"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -20,7 +19,12 @@ type GitCmd struct {
 	wrapper codecommit.RepoWrapper
 	sess    *session.Session
 	region  *string
-	roleARN *string
+	roles   roleChain
+	profile string
+
+	//cache assumed role credentials when set, scoped to cacheScope (host/path)
+	cache      *credentialCache
+	cacheScope string
 }
 
 func (g *GitCmd) execute(cmd *cobra.Command, args []string) error {
@@ -75,31 +79,62 @@ func (g *GitCmd) clone(args []string, flags *pflag.FlagSet) error {
 		url, args = args[0], args[1:]
 	}
 
-	if codecommit.IsCodeCommitURL(url) {
-		roleARN, err := flags.GetString("role-arn")
+	if codecommit.IsRepositoryReference(url) {
+		// there is no repository git config to read before cloning
+		id, err := resolveIdentity(url, "")
+		if err != nil {
+			return err
+		}
+		if err := id.setFlags(flags); err != nil {
+			return err
+		}
+
+		region, err := flags.GetString("region")
 		if err != nil {
 			return err
 		}
-		if roleARN != "" && os.Getenv(envKeyAwsProfile) != "" {
-			return fmt.Errorf("only one of role arn or profile should be set")
+		profile, err := flags.GetString("profile")
+		if err != nil {
+			return err
 		}
-		if roleARN != "" {
-			g.roleARN = &roleARN
+		repo, err := parseRepository(url, region, profile)
+		if err != nil {
+			return err
+		}
+		if g.profile, err = parseProfile(flags, repo); err != nil {
+			return err
 		}
 
-		region, err := codecommit.ParseRegion(url)
-		g.region = &region
+		roles, err := parseRoleChain(flags)
+		if err != nil {
+			return err
+		}
+		if err := roles.checkPartition(&repo.Endpoint); err != nil {
+			return err
+		}
+		g.roles = roles
+		g.region = &repo.Region
+		if g.cache, err = flagCache(flags); err != nil {
+			return err
+		}
+		g.cacheScope = repo.URL()
 
 		sess, err := g.session()
 		if err != nil {
 			return err
 		}
-		cloneURL, err := codecommit.NewCloneURL(sess, url)
+		options, err := cloneURLOptions(flags)
+		if err != nil {
+			return err
+		}
+		cloneURL, err := codecommit.NewCloneURL(sess, repo.URL(), options...)
 		if err != nil {
 			return err
 		}
 
-		url = cloneURL.String()
+		if url, err = cloneURL.SignedURL(); err != nil {
+			return err
+		}
 	}
 
 	var dest string
@@ -130,13 +165,17 @@ func (g *GitCmd) session() (*session.Session, error) {
 		cfg := &aws.Config{
 			Region: g.region,
 		}
-		sess, err := session.NewSession(cfg)
+		sess, err := newSession(cfg, g.profile, g.cache)
 		if err != nil {
 			return nil, err
 		}
 
-		if g.roleARN != nil {
-			sess.Config.Credentials = stscreds.NewCredentials(sess, *g.roleARN)
+		if g.roles != nil {
+			creds, err := g.roles.credentials(sess, g.cache, g.cacheScope)
+			if err != nil {
+				return nil, err
+			}
+			sess.Config.Credentials = creds
 		}
 		g.sess = sess
 	}
@@ -152,15 +191,24 @@ func newCloneCmd() *cobra.Command {
 
 See: %s for more details
 
+` + repositoryFormsDoc + `
+
 Example usage:
 
 codecommit clone https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo .
+codecommit clone --region us-east-1 your-repo
+
+` + identityPrecedenceDoc + `
 `,
 		RunE: c.execute,
 		Args: cobra.MaximumNArgs(2),
 	}
 
-	cmd.Flags().String("role-arn", os.Getenv(envKeyCodeCommitRoleARN), "role to assume when retrieving aws credentials, requires 'AWS_ACCESS_KEY_ID' and 'AWS_SECRET_KEY_ID' env vars to be set")
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	addRegionFlag(cmd)
+	addCacheFlag(cmd)
+	addClockSkewFlag(cmd)
 	return cmd
 }
 
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"strings"
+)
+
+//GitRequest contains elements from a parsed Git helper input
+//See https://git-scm.com/docs/git-credential#IOFMT
+type GitRequest struct {
+	protocol string
+	path     string
+	host     string
+	username string
+	password string
+
+	//capability lists the features git supports, eg. "authtype"
+	capability []string
+	//wwwauth contains the WWW-Authenticate headers sent by the server
+	wwwauth []string
+	//extra holds attributes which are not interpreted, as "key=value" lines
+	extra []string
+}
+
+func (g *GitRequest) url() string {
+	u := nurl.URL{
+		Host:   g.host,
+		Path:   g.path,
+		Scheme: g.protocol,
+	}
+	return u.String()
+}
+
+//setURL sets the request attributes from the components of rawURL, as git
+//does for the "url" attribute.
+func (g *GitRequest) setURL(rawURL string) error {
+	u, err := nurl.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	g.protocol = u.Scheme
+	g.host = u.Host
+	g.path = strings.TrimPrefix(u.Path, "/")
+	if u.User != nil {
+		g.username = u.User.Username()
+		if password, isset := u.User.Password(); isset {
+			g.password = password
+		}
+	}
+	return nil
+}
+
+//parseGitRequest reads a credential description from r, stopping at a blank
+//line or the end of input. Unknown attributes are kept but not interpreted.
+func parseGitRequest(r io.Reader) (GitRequest, error) {
+	g := GitRequest{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			break
+		}
+		i := strings.Index(line, "=")
+		if i < 1 {
+			return g, fmt.Errorf("invalid credential attribute %q", line)
+		}
+		key, value := line[:i], line[i+1:]
+
+		switch key {
+		case "url":
+			if err := g.setURL(value); err != nil {
+				return g, fmt.Errorf("invalid credential url %q: %v", value, err)
+			}
+		case "protocol":
+			g.protocol = value
+		case "host":
+			g.host = value
+		case "path":
+			g.path = value
+		case "username":
+			g.username = value
+		case "password":
+			g.password = value
+		case "capability[]":
+			g.capability = appendMulti(g.capability, value)
+		case "wwwauth[]":
+			g.wwwauth = appendMulti(g.wwwauth, value)
+		default:
+			g.extra = append(g.extra, line)
+		}
+	}
+	return g, scanner.Err()
+}
+
+//write the request to w in the git credential protocol, terminated by a blank line
+func (g *GitRequest) write(w io.Writer) error {
+	var b strings.Builder
+	attrs := [][2]string{
+		{"protocol", g.protocol},
+		{"host", g.host},
+		{"path", g.path},
+		{"username", g.username},
+		{"password", g.password},
+	}
+	for _, attr := range attrs {
+		if attr[1] != "" {
+			fmt.Fprintf(&b, "%s=%s\n", attr[0], attr[1])
+		}
+	}
+	for _, v := range g.capability {
+		fmt.Fprintf(&b, "capability[]=%s\n", v)
+	}
+	for _, v := range g.wwwauth {
+		fmt.Fprintf(&b, "wwwauth[]=%s\n", v)
+	}
+	for _, line := range g.extra {
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	b.WriteString("\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+//appendMulti appends value to a multi-valued attribute, an empty value clears the attribute
+func appendMulti(values []string, value string) []string {
+	if value == "" {
+		return nil
+	}
+	return append(values, value)
+}
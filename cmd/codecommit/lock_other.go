@@ -0,0 +1,23 @@
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+//checkFileLocks return an error, the credential cache is disabled where file
+//locks are not available as concurrent processes could not share credentials.
+func checkFileLocks() error {
+	return fmt.Errorf("the credential cache is not supported on %s, which lacks file locks", runtime.GOOS)
+}
+
+func lockFile(f *os.File) error {
+	return checkFileLocks()
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"os"
 
 	"github.com/spf13/cobra"
@@ -14,18 +13,6 @@ const (
 	envKeyAwsSDKLoadConfig = "AWS_SDK_LOAD_CONFIG"
 )
 
-func setSDKLoadConfig() error {
-	if _, isset := os.LookupEnv(envKeyAwsProfile); !isset {
-		return nil
-	}
-	if _, isset := os.LookupEnv(envKeyAwsSDKLoadConfig); !isset {
-		if err := os.Setenv(envKeyAwsSDKLoadConfig, "1"); err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
 func main() {
 	rootCmd := &cobra.Command{
 		Use:   "codecommit",
@@ -38,18 +25,26 @@ func main() {
 		return nil
 	}
 
-	if err := setSDKLoadConfig(); err != nil {
-		fmt.Print(err)
-		os.Exit(1)
-	}
-
 	rootCmd.AddCommand(newCredentialsCmd())
 	rootCmd.AddCommand(newCredentialHelperCmd())
+	rootCmd.AddCommand(newCredentialDaemonCmd())
 	rootCmd.AddCommand(newCloneCmd())
 	rootCmd.AddCommand(newPullCmd())
 	rootCmd.AddCommand(newPushCmd())
+	rootCmd.AddCommand(newRemoteHelperCmd())
+	rootCmd.AddCommand(newDebugSignatureCmd())
+	rootCmd.AddCommand(newNetrcCmd())
+	rootCmd.AddCommand(newAskpassCmd())
+	rootCmd.AddCommand(newExecCmd())
 	rootCmd.AddCommand(newVersionCmd())
 
+	if isRemoteHelper(os.Args[0]) {
+		rootCmd.SetArgs(append([]string{"remote-helper"}, os.Args[1:]...))
+	}
+	if isAskpass(os.Args[0]) {
+		rootCmd.SetArgs(append([]string{"askpass"}, os.Args[1:]...))
+	}
+
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
 	}
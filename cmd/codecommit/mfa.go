@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const (
+	envKeyCodeCommitMFASerial  = "CODECOMMIT_MFA_SERIAL"
+	envKeyCodeCommitMFAAskpass = "CODECOMMIT_MFA_ASKPASS"
+
+	//ttyPath is read for MFA codes, stdin is used by the git credential protocol
+	ttyPath = "/dev/tty"
+)
+
+//mfaTokenProvider return a stscreds.AssumeRoleProvider TokenProvider which
+//prompts for the MFA code of serial by running askpass, or on the terminal
+//when askpass is empty.
+func mfaTokenProvider(serial, askpass string) func() (string, error) {
+	return func() (string, error) {
+		prompt := fmt.Sprintf("MFA code for %s: ", serial)
+		read := readTerminal
+		if askpass != "" {
+			read = func(prompt string) (string, error) {
+				return runAskpass(askpass, prompt)
+			}
+		}
+		code, err := read(prompt)
+		if err != nil {
+			return "", fmt.Errorf("unable to read MFA code for %s: %v", serial, err)
+		}
+		if code = strings.TrimSpace(code); code == "" {
+			return "", fmt.Errorf("no MFA code entered for %s", serial)
+		}
+		return code, nil
+	}
+}
+
+//runAskpass runs the askpass program with prompt as its argument and return
+//its output, like GIT_ASKPASS and SSH_ASKPASS programs.
+func runAskpass(askpass, prompt string) (string, error) {
+	cmd := exec.Command(askpass, prompt)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("askpass %q failed: %v", askpass, err)
+	}
+	return string(out), nil
+}
+
+//readTerminal writes prompt to, and reads a line from, the controlling terminal
+func readTerminal(prompt string) (string, error) {
+	tty, err := os.OpenFile(ttyPath, os.O_RDWR, 0)
+	if err != nil {
+		return "", fmt.Errorf("no terminal to prompt on, set --mfa-askpass or %s: %v", envKeyCodeCommitMFAAskpass, err)
+	}
+	defer tty.Close()
+
+	if _, err := fmt.Fprint(tty, prompt); err != nil {
+		return "", err
+	}
+	return bufio.NewReader(tty).ReadString('\n')
+}
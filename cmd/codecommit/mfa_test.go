@@ -0,0 +1,69 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/spf13/cobra"
+)
+
+// TestMFATokenProvider tests that the MFA code is read from the askpass program.
+func TestMFATokenProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestMFATokenProvider-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	askpass := filepath.Join(dir, "askpass")
+	script := "#!/bin/sh\necho \"$1\" > " + filepath.Join(dir, "prompt") + "\necho 123456\n"
+	if err := ioutil.WriteFile(askpass, []byte(script), 0700); err != nil {
+		t.Fatalf("Failed to write askpass, err=%v", err)
+	}
+
+	serial := "arn:aws:iam::123456789012:mfa/user"
+	code, err := mfaTokenProvider(serial, askpass)()
+	if err != nil {
+		t.Fatalf("Failed to read MFA code, err=%v", err)
+	}
+	if code != "123456" {
+		t.Errorf("Expected MFA code %q, actual %q", "123456", code)
+	}
+	prompt, _ := ioutil.ReadFile(filepath.Join(dir, "prompt"))
+	if expected := "MFA code for " + serial + ": \n"; string(prompt) != expected {
+		t.Errorf("Expected prompt %q, actual %q", expected, prompt)
+	}
+
+	if _, err := mfaTokenProvider(serial, filepath.Join(dir, "missing"))(); err == nil {
+		t.Errorf("Expected error for missing askpass")
+	}
+}
+
+// TestParseRoleChainMFA tests that MFA is only required to assume the first role.
+func TestParseRoleChainMFA(t *testing.T) {
+	cmd := &cobra.Command{}
+	addRoleFlags(cmd)
+	cmd.Flags().Parse([]string{"--role-arn", "a,b", "--mfa-serial", "serial"})
+	chain, err := parseRoleChain(cmd.Flags())
+	if err != nil {
+		t.Fatalf("Failed to parse roles, err=%v", err)
+	}
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("us-east-1")}))
+	if p := chain[0].assumeRoleProvider(sess); aws.StringValue(p.SerialNumber) != "serial" || p.TokenProvider == nil {
+		t.Errorf("Expected first role to require MFA, actual %v", aws.StringValue(p.SerialNumber))
+	}
+	if p := chain[1].assumeRoleProvider(sess); p.SerialNumber != nil {
+		t.Errorf("Expected second role not to require MFA, actual %v", aws.StringValue(p.SerialNumber))
+	}
+
+	cmd = &cobra.Command{}
+	addRoleFlags(cmd)
+	cmd.Flags().Parse([]string{"--mfa-serial", "serial"})
+	if _, err := parseRoleChain(cmd.Flags()); err == nil {
+		t.Errorf("Expected error for MFA without a role")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const envKeyNetrc = "NETRC"
+
+//Netrc writes the CodeCommit credentials of repositories to a .netrc file
+type Netrc struct {
+	CodeCommitCredentials
+}
+
+func (n *Netrc) execute(cmd *cobra.Command, args []string) error {
+	f := cmd.Flags()
+
+	file, err := f.GetString("file")
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		return fmt.Errorf("no .netrc file, set --file or %s", envKeyNetrc)
+	}
+	remove, err := f.GetBool("remove")
+	if err != nil {
+		return err
+	}
+
+	// entries of hosts, empty when the host's entry is removed
+	entries := map[string]string{}
+	refs := map[string]string{}
+	restore := saveFlags(f)
+	for _, ref := range args {
+		host, entry, err := n.entry(f, ref, remove)
+		restore()
+		if err != nil {
+			return err
+		}
+		if other, ok := refs[host]; ok && !remove {
+			return fmt.Errorf("%s and %s are both on %s, .netrc entries are per host but CodeCommit passwords are per repository",
+				other, ref, host)
+		}
+		entries[host], refs[host] = entry, ref
+	}
+
+	data, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return writeFileAtomic(file, updateNetrc(data, entries), 0600)
+}
+
+//entry return the host of the repository ref, and its .netrc machine entry
+//with the current credentials unless remove is set.
+func (n *Netrc) entry(f *pflag.FlagSet, ref string, remove bool) (string, string, error) {
+	n.CodeCommitCredentials = CodeCommitCredentials{}
+	url, err := n.configureRepository(f, ref)
+	if err != nil {
+		return "", "", err
+	}
+	if remove {
+		repo, err := codecommit.ParseRepository(url, "")
+		if err != nil {
+			return "", "", err
+		}
+		return repo.Host, "", nil
+	}
+
+	values, err := n.values(url)
+	if err != nil {
+		return "", "", n.describeError(err)
+	}
+	var b bytes.Buffer
+	if err := outputs["netrc"](&b, values); err != nil {
+		return "", "", err
+	}
+	return values.Host, b.String(), nil
+}
+
+//netrcToken is a token of a .netrc file and its offsets
+type netrcToken struct {
+	value      string
+	start, end int
+}
+
+//netrcTokens return the tokens of a .netrc file, skipping comments. The
+//body of a macdef is returned as a single token.
+func netrcTokens(data []byte) []netrcToken {
+	var tokens []netrcToken
+	for i := 0; i < len(data); {
+		switch c := data[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(data) && data[i] != '\n' {
+				i++
+			}
+		default:
+			start := i
+			for i < len(data) && !strings.ContainsRune(" \t\r\n", rune(data[i])) {
+				i++
+			}
+			tokens = append(tokens, netrcToken{string(data[start:i]), start, i})
+
+			// a macro runs from the line after "macdef name" to a blank line
+			if n := len(tokens); n >= 2 && tokens[n-2].value == "macdef" {
+				for i < len(data) && data[i] != '\n' {
+					i++
+				}
+				start := i
+				if end := bytes.Index(data[i:], []byte("\n\n")); end >= 0 {
+					i += end + 1
+				} else {
+					i = len(data)
+				}
+				tokens = append(tokens, netrcToken{string(data[start:i]), start, i})
+			}
+		}
+	}
+	return tokens
+}
+
+//updateNetrc return the .netrc data with the machine entries of the hosts in
+//entries replaced by their entry, or removed if it is empty. New entries are
+//appended, other entries, comments and blank lines are kept as they are.
+func updateNetrc(data []byte, entries map[string]string) []byte {
+	var out bytes.Buffer
+	written := map[string]bool{}
+	tokens := netrcTokens(data)
+	last := 0
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].value != "machine" || i+1 == len(tokens) {
+			continue
+		}
+		host := tokens[i+1].value
+		entry, ok := entries[host]
+		if !ok {
+			continue
+		}
+
+		// the entry ends with the line of its last token, before the next entry
+		j := i + 2
+		for j < len(tokens) && tokens[j].value != "machine" && tokens[j].value != "default" {
+			j++
+		}
+		end := tokens[j-1].end
+		// macro bodies already end with their newline
+		if data[end-1] != '\n' {
+			if nl := bytes.IndexByte(data[end:], '\n'); nl >= 0 {
+				end += nl + 1
+			} else {
+				end = len(data)
+			}
+		}
+
+		out.Write(data[last:tokens[i].start])
+		if !written[host] {
+			out.WriteString(entry)
+			written[host] = true
+		}
+		last, i = end, j-1
+	}
+	out.Write(data[last:])
+
+	var hosts []string
+	for host, entry := range entries {
+		if entry != "" && !written[host] {
+			hosts = append(hosts, host)
+		}
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if out.Len() > 0 && !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteString("\n")
+		}
+		out.WriteString(entries[host])
+	}
+	return out.Bytes()
+}
+
+//netrcPath return the path of the .netrc file, $NETRC or ~/.netrc (~/_netrc on Windows)
+func netrcPath() string {
+	if path := os.Getenv(envKeyNetrc); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(home, "_netrc")
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+func newNetrcCmd() *cobra.Command {
+	n := &Netrc{}
+	cmd := &cobra.Command{
+		Use:   "netrc [options] URL...",
+		Short: "Write CodeCommit credentials for URLs to ~/.netrc",
+		Long: fmt.Sprintf(`Write or refresh the .netrc machine entries of CodeCommit repositories, for
+tools which only read ~/.netrc, eg. go get of private modules and curl.
+
+Other entries of the file are left as they are, the file is written atomically
+and is only readable by its owner. --remove removes the repositories' entries.
+
+The passwords expire with the credentials they are signed with, after at most
+15 minutes, so re-run the command before each use. Entries are per host but
+passwords are per repository, so only one repository per region can be set.
+
+%s
+
+Example usage:
+
+codecommit netrc https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo
+codecommit netrc --remove https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo
+
+%s
+`, repositoryFormsDoc, identityPrecedenceDoc),
+		RunE: n.execute,
+		Args: cobra.MinimumNArgs(1),
+	}
+
+	cmd.Flags().String("file", netrcPath(),
+		fmt.Sprintf("the .netrc file to write\nCan be set from the environment with %s", envKeyNetrc))
+	cmd.Flags().Bool("remove", false, "remove the entries of the repositories")
+	addRegionFlag(cmd)
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	addCacheFlag(cmd)
+	addClockSkewFlag(cmd)
+	return cmd
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+const testNetrc = `# work
+machine example.com login me password secret
+
+machine git-codecommit.us-east-1.amazonaws.com
+  login OLD
+  password OLD
+macdef init
+machine git-codecommit.eu-west-1.amazonaws.com
+
+default login anonymous password me@example.com`
+
+// TestUpdateNetrc tests that only the entries of the hosts are replaced, removed or appended.
+func TestUpdateNetrc(t *testing.T) {
+	entries := map[string]string{
+		"git-codecommit.us-east-1.amazonaws.com":    "machine git-codecommit.us-east-1.amazonaws.com login NEW password NEW\n",
+		"git-codecommit.eu-west-1.amazonaws.com":    "machine git-codecommit.eu-west-1.amazonaws.com login EU password EU\n",
+		"git-codecommit.ca-central-1.amazonaws.com": "",
+	}
+	expected := `# work
+machine example.com login me password secret
+
+machine git-codecommit.us-east-1.amazonaws.com login NEW password NEW
+
+default login anonymous password me@example.com
+machine git-codecommit.eu-west-1.amazonaws.com login EU password EU
+`
+	if actual := string(updateNetrc([]byte(testNetrc), entries)); actual != expected {
+		t.Errorf("Expected:\n%s\nactual:\n%s", expected, actual)
+	}
+
+	entries = map[string]string{"git-codecommit.us-east-1.amazonaws.com": ""}
+	expected = `# work
+machine example.com login me password secret
+
+
+default login anonymous password me@example.com`
+	if actual := string(updateNetrc([]byte(testNetrc), entries)); actual != expected {
+		t.Errorf("Expected:\n%s\nactual:\n%s", expected, actual)
+	}
+
+	entries = map[string]string{"example.com": "machine example.com login new password new\n"}
+	if actual := string(updateNetrc(nil, entries)); actual != entries["example.com"] {
+		t.Errorf("Expected %q, actual %q", entries["example.com"], actual)
+	}
+}
+
+// TestSaveFlags tests that flags set for one repository are restored for the next.
+func TestSaveFlags(t *testing.T) {
+	cmd := &cobra.Command{}
+	addRegionFlag(cmd)
+	addRoleFlags(cmd)
+	f := cmd.Flags()
+	f.Parse([]string{"--role-arn", "arn:aws:iam::111111111111:role/a"})
+
+	restore := saveFlags(f)
+	f.Set("region", "eu-west-1")
+	f.Set("role-arn", "arn:aws:iam::222222222222:role/b")
+	restore()
+
+	if region, _ := f.GetString("region"); region != "" || f.Changed("region") {
+		t.Errorf("Expected region to be restored, actual %q", region)
+	}
+	if arns, _ := f.GetStringSlice("role-arn"); len(arns) != 1 || arns[0] != "arn:aws:iam::111111111111:role/a" {
+		t.Errorf("Expected role-arn to be restored, actual %v", arns)
+	}
+}
+
+// TestWriteFileAtomicSymlink tests that the target of a symlinked file is replaced rather than the link.
+func TestWriteFileAtomicSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestWriteFileAtomicSymlink-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "dotfiles-netrc")
+	link := filepath.Join(dir, ".netrc")
+	if err := ioutil.WriteFile(target, []byte("old"), 0600); err != nil {
+		t.Fatalf("Failed to write file, err=%v", err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("Symlinks are not supported, err=%v", err)
+	}
+
+	if err := writeFileAtomic(link, []byte("new"), 0600); err != nil {
+		t.Fatalf("Failed to write file, err=%v", err)
+	}
+	if fi, err := os.Lstat(link); err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected %s to remain a symlink, err=%v", link, err)
+	}
+	if data, err := ioutil.ReadFile(target); err != nil || string(data) != "new" {
+		t.Errorf("Expected the target to be written, actual %q, err=%v", data, err)
+	}
+}
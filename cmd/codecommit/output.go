@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	nurl "net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	netrcTemplate = `machine {{ .Host }} login {{ .Credentials.Username }} password {{ .Credentials.Password }}
+`
+	urlTemplate = `{{ .CloneURL }}
+`
+)
+
+//outputFunc writes the values of credentials in an output format
+type outputFunc func(w io.Writer, v *Values) error
+
+//outputs are the built-in output formats of the credential command
+var outputs = map[string]outputFunc{
+	"helper": templateOutput(helperTemplate),
+	"json":   jsonOutput,
+	"env":    envOutput,
+	"netrc":  templateOutput(netrcTemplate),
+	"url":    templateOutput(urlTemplate),
+	//git-credentials is the format of git credential-store files, one URL per line
+	"git-credentials": templateOutput(urlTemplate),
+}
+
+//outputNames return the names of the built-in output formats
+func outputNames() []string {
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+//parseOutput return the output format set by the output or template flags
+func parseOutput(f *pflag.FlagSet) (outputFunc, error) {
+	output, err := f.GetString("output")
+	if err != nil {
+		return nil, err
+	}
+	format, err := f.GetString("template")
+	if err != nil {
+		return nil, err
+	}
+	if format != "" {
+		if f.Changed("output") {
+			return nil, fmt.Errorf("only one of output or template should be set")
+		}
+		t, err := template.New("format").Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template: %v", err)
+		}
+		return func(w io.Writer, v *Values) error {
+			return t.Execute(w, v)
+		}, nil
+	}
+	write, ok := outputs[output]
+	if !ok {
+		return nil, fmt.Errorf("unsupported output %q, expected one of %s", output, strings.Join(outputNames(), ", "))
+	}
+	return write, nil
+}
+
+//templateOutput return an outputFunc executing the template format
+func templateOutput(format string) outputFunc {
+	t := template.Must(template.New("format").Parse(format))
+	return func(w io.Writer, v *Values) error {
+		return t.Execute(w, v)
+	}
+}
+
+//jsonOutput writes v as a JSON object
+func jsonOutput(w io.Writer, v *Values) error {
+	out := struct {
+		Username   string    `json:"username"`
+		Password   string    `json:"password"`
+		Expiry     time.Time `json:"expiry"`
+		URL        string    `json:"url"`
+		CloneURL   string    `json:"clone_url"`
+		Region     string    `json:"region"`
+		Repository string    `json:"repository"`
+		Host       string    `json:"host"`
+		AccountID  string    `json:"account_id,omitempty"`
+		Role       string    `json:"role,omitempty"`
+	}{
+		Username:   v.Credentials.Username,
+		Password:   v.Credentials.Password,
+		Expiry:     v.Expiry.UTC(),
+		URL:        v.URL,
+		CloneURL:   v.CloneURL,
+		Region:     v.Region,
+		Repository: v.Repository,
+		Host:       v.Host,
+		AccountID:  v.AccountID,
+		Role:       v.Role,
+	}
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(out)
+}
+
+//envOutput writes v as shell export statements, for eval "$(codecommit credential --output env)"
+func envOutput(w io.Writer, v *Values) error {
+	vars := [][2]string{
+		{"CODECOMMIT_USERNAME", v.Credentials.Username},
+		{"CODECOMMIT_PASSWORD", v.Credentials.Password},
+		{"CODECOMMIT_PASSWORD_EXPIRY", v.Expiry.UTC().Format(time.RFC3339)},
+		{envKeyCodeCommitURL, v.URL},
+		{"CODECOMMIT_REGION", v.Region},
+		{"CODECOMMIT_REPOSITORY", v.Repository},
+		{"CODECOMMIT_HOST", v.Host},
+		{"CODECOMMIT_ACCOUNT_ID", v.AccountID},
+		{"CODECOMMIT_ASSUMED_ROLE_ARN", v.Role},
+	}
+	for _, kv := range vars {
+		if kv[1] == "" {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "export %s=%s\n", kv[0], shellQuote(kv[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//shellQuote return s single quoted for POSIX shells
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+//credentialURL return url with the username and password embedded
+func credentialURL(url, username, password string) (string, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return "", err
+	}
+	u.User = nurl.UserPassword(username, password)
+	return u.String(), nil
+}
+
+//arnAccountID return the account ID of arn, empty if it is not an ARN
+func arnAccountID(arn string) string {
+	parts := strings.SplitN(arn, ":", 6)
+	if len(parts) != 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[4]
+}
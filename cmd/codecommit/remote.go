@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/spf13/cobra"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const (
+	//remoteHelperName is the name git runs for "codecommit::" remotes
+	remoteHelperName = "git-remote-codecommit"
+
+	envKeyRemoteUsername = "CODECOMMIT_REMOTE_USERNAME"
+	envKeyRemotePassword = "CODECOMMIT_REMOTE_PASSWORD"
+
+	//remoteCredentialHelper answers git-remote-https with the credentials in
+	//its environment, which unlike arguments other users can not read.
+	remoteCredentialHelper = `!f() { if test "$1" = get; then printf 'username=%s\npassword=%s\n' "$` +
+		envKeyRemoteUsername + `" "$` + envKeyRemotePassword + `"; fi; }; f`
+)
+
+//RemoteHelper implements git-remote-codecommit by delegating to git-remote-https
+//with the HTTPS URL, and credentials for it from a credential helper.
+//See https://git-scm.com/docs/gitremote-helpers
+type RemoteHelper struct {
+	sess    *session.Session
+	region  string
+	profile string
+	roles   roleChain
+
+	//cache assumed role credentials when set, scoped to cacheScope (host/path)
+	cache      *credentialCache
+	cacheScope string
+}
+
+//isRemoteHelper return true if the program was run as git-remote-codecommit, eg. through a symlink
+func isRemoteHelper(arg0 string) bool {
+	name := strings.TrimSuffix(filepath.Base(arg0), ".exe")
+	return name == remoteHelperName
+}
+
+func (h *RemoteHelper) execute(cmd *cobra.Command, args []string) error {
+	// git runs "git-remote-codecommit <remote> <url>", or with only the URL
+	remote, url := args[0], args[0]
+	if len(args) == 2 {
+		url = args[1]
+	}
+
+	// git strips the "codecommit::" prefix from <transport>::<address> URLs
+	if !strings.HasPrefix(url, codecommit.RemoteScheme+":") {
+		url = codecommit.RemoteScheme + "::" + url
+	}
+	// git runs remote helpers in the repository, its git config may set the identity
+	id, err := resolveIdentity(url, ".")
+	if err != nil {
+		return err
+	}
+	if err := id.setFlags(cmd.Flags()); err != nil {
+		return err
+	}
+	profile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return err
+	}
+	repo, err := parseRepository(url, "", profile)
+	if err != nil {
+		return err
+	}
+	if h.profile, err = parseProfile(cmd.Flags(), repo); err != nil {
+		return err
+	}
+	h.region = repo.Region
+
+	roles, err := parseRoleChain(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	if err := roles.checkPartition(&repo.Endpoint); err != nil {
+		return err
+	}
+	h.roles = roles
+	if h.cache, err = flagCache(cmd.Flags()); err != nil {
+		return err
+	}
+	h.cacheScope = repo.URL()
+
+	sess, err := h.session()
+	if err != nil {
+		return err
+	}
+	options, err := cloneURLOptions(cmd.Flags())
+	if err != nil {
+		return err
+	}
+	cloneURL, err := codecommit.NewCloneURL(sess, repo.URL(), options...)
+	if err != nil {
+		return describeError(err, h.profile, h.roles.String())
+	}
+	creds, err := cloneURL.GetCodeCommitCredentials()
+	if err != nil {
+		return describeError(err, h.profile, h.roles.String())
+	}
+
+	return h.delegate(remote, repo.URL(), creds)
+}
+
+//remoteArgs return the git arguments running git-remote-https for url, with
+//remoteCredentialHelper as the only credential helper for it.
+func remoteArgs(remote, url string) []string {
+	var args []string
+	for _, kv := range credentialConfig(remoteCredentialHelper, []string{url}) {
+		args = append(args, "-c", kv[0]+"="+kv[1])
+	}
+	return append(args, "remote-https", remote, url)
+}
+
+//delegate runs git-remote-https for url, connected to git through stdin and
+//stdout, with creds in its environment. Its exit status is passed on to git.
+func (h *RemoteHelper) delegate(remote, url string, creds *codecommit.CodeCommitCredentials) error {
+	c := exec.Command("git", remoteArgs(remote, url)...)
+	c.Env = append(os.Environ(),
+		envKeyRemoteUsername+"="+creds.Username,
+		envKeyRemotePassword+"="+creds.Password)
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	err := c.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		os.Exit(exitErr.ExitCode())
+	}
+	return err
+}
+
+//session getter/setter returns *session.session
+func (h *RemoteHelper) session() (*session.Session, error) {
+	if h.sess == nil {
+		sess, err := newSession(&aws.Config{Region: &h.region}, h.profile, h.cache)
+		if err != nil {
+			return nil, err
+		}
+		if len(h.roles) > 0 {
+			creds, err := h.roles.credentials(sess, h.cache, h.cacheScope)
+			if err != nil {
+				return nil, err
+			}
+			sess.Config.Credentials = creds
+		}
+		h.sess = sess
+	}
+	return h.sess, nil
+}
+
+func newRemoteHelperCmd() *cobra.Command {
+	h := &RemoteHelper{}
+	cmd := &cobra.Command{
+		Use:   "remote-helper REMOTE [URL]",
+		Short: "Git remote helper for codecommit:: URLs, compatible with git-remote-codecommit",
+		Long: fmt.Sprintf(`Git remote helper for codecommit:: URLs, compatible with git-remote-codecommit
+
+Git runs %[1]s for codecommit:: remotes, install it by linking
+to codecommit, which then runs this command:
+
+ln -s $(command -v codecommit) /usr/local/bin/%[1]s
+
+Supported URLs, where the region and profile are optional:
+
+codecommit://[profile@]repository
+codecommit::<region>://[profile@]repository
+
+Example usage:
+
+git clone codecommit::us-east-1://your-profile@your-repo
+
+%[2]s
+`, remoteHelperName, identityPrecedenceDoc),
+		RunE: h.execute,
+		Args: cobra.RangeArgs(1, 2),
+	}
+	addProfileFlag(cmd)
+	addRoleFlags(cmd)
+	addCacheFlag(cmd)
+	addClockSkewFlag(cmd)
+	return cmd
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// TestIsRemoteHelper tests that the remote helper mode is detected from the program name.
+func TestIsRemoteHelper(t *testing.T) {
+	tests := map[string]bool{
+		"/usr/local/bin/git-remote-codecommit":   true,
+		"git-remote-codecommit.exe":              true,
+		"/usr/local/bin/codecommit":              false,
+		"/usr/local/bin/git-remote-codecommit-x": false,
+	}
+	for arg0, expected := range tests {
+		if actual := isRemoteHelper(arg0); actual != expected {
+			t.Errorf("expected %v for %q, actual %v", expected, arg0, actual)
+		}
+	}
+}
+
+// TestRemoteCredentialHelper tests that git-remote-https gets the credentials from the environment rather than arguments.
+func TestRemoteCredentialHelper(t *testing.T) {
+	url := "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/your-repo"
+	args := remoteArgs("origin", url)
+	if len(args) < 3 || args[len(args)-3] != "remote-https" || args[len(args)-1] != url {
+		t.Fatalf("Unexpected arguments %q", args)
+	}
+
+	// run git credential fill with the same config, as git-remote-https does
+	fill := append(args[:len(args)-3], "credential", "fill")
+	cmd := exec.Command("git", fill...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0",
+		envKeyRemoteUsername+"=AKID%TOKEN", envKeyRemotePassword+"=20060102T150405Zsig")
+	cmd.Stdin = strings.NewReader("url=" + url + "\n\n")
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("git %q failed, err=%v", fill, err)
+	}
+	for _, expected := range []string{"username=AKID%TOKEN\n", "password=20060102T150405Zsig\n"} {
+		if !strings.Contains(string(out), expected) {
+			t.Errorf("Expected %q in %q", expected, out)
+		}
+	}
+}
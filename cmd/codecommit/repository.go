@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const (
+	envKeyAwsRegion = "AWS_REGION"
+
+	repositoryFormsDoc = `The repository can be referenced by any of:
+
+arn:aws:codecommit:eu-west-1:123456789012:your-repo
+your-repo (with --region)
+codecommit::eu-west-1://[profile@]your-repo
+https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/your-repo`
+)
+
+//sharedConfigState return whether the shared config is loaded, it is unless
+//AWS_SDK_LOAD_CONFIG is set to false so that the region, roles and credential
+//processes of profiles are used whether the profile is set by flag or not.
+func sharedConfigState() session.SharedConfigState {
+	if v, isset := os.LookupEnv(envKeyAwsSDKLoadConfig); isset {
+		if load, err := strconv.ParseBool(v); err == nil && !load {
+			return session.SharedConfigDisable
+		}
+	}
+	return session.SharedConfigEnable
+}
+
+//newSession return a session for cfg, using the shared config of profile, or
+//of the SDK's default profile if not set. The credentials of SSO profiles,
+//which the SDK does not support, are retrieved with the access token cached
+//by aws sso login, and cached in cache if it is not nil.
+func newSession(cfg *aws.Config, profile string, cache *credentialCache) (*session.Session, error) {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            *cfg,
+		Profile:           profile,
+		SharedConfigState: sharedConfigState(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := setSSOCredentials(sess, profile, cache); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+//configRegion return the region from the AWS config for profile, empty if not set
+func configRegion(profile string) string {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           profile,
+		SharedConfigState: sharedConfigState(),
+	})
+	if err != nil {
+		return ""
+	}
+	return aws.StringValue(sess.Config.Region)
+}
+
+//parseRepository return the repository for ref, references without a region
+//use region or else the region from the AWS config of the URL's profile or profile.
+func parseRepository(ref, region, profile string) (*codecommit.Repository, error) {
+	if region == "" {
+		if r, err := codecommit.ParseRemoteURL(ref); err == nil && r.Profile != "" {
+			profile = r.Profile
+		}
+		region = configRegion(profile)
+	}
+	return codecommit.ParseRepository(ref, region)
+}
+
+//addProfileFlag adds the --profile flag to cmd
+func addProfileFlag(cmd *cobra.Command) {
+	cmd.Flags().String("profile", os.Getenv(envKeyAwsProfile),
+		fmt.Sprintf(`AWS profile to use, roles are assumed with the profile's credentials
+Can be set from the environment with %s`, envKeyAwsProfile))
+}
+
+//parseProfile return the profile of repo, that of codecommit:: URLs takes
+//precedence over the --profile flag.
+func parseProfile(f *pflag.FlagSet, repo *codecommit.Repository) (string, error) {
+	if repo != nil && repo.Profile != "" {
+		return repo.Profile, nil
+	}
+	return f.GetString("profile")
+}
+
+//addRegionFlag adds the --region flag to cmd, for repositories referenced by name
+func addRegionFlag(cmd *cobra.Command) {
+	cmd.Flags().String("region", os.Getenv(envKeyAwsRegion),
+		"region of repositories referenced by name, defaults to the AWS config")
+}
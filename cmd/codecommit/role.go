@@ -0,0 +1,384 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	nurl "net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const (
+	envKeyCodeCommitRoleSessionName = "CODECOMMIT_ROLE_SESSION_NAME"
+	envKeyCodeCommitExternalID      = "CODECOMMIT_EXTERNAL_ID"
+	envKeyCodeCommitRoleDuration    = "CODECOMMIT_ROLE_DURATION"
+	envKeyCodeCommitSessionTags     = "CODECOMMIT_SESSION_TAGS"
+	envKeyCodeCommitSourceIdentity  = "CODECOMMIT_SOURCE_IDENTITY"
+
+	//mfaRoleDuration is the default duration of a role session assumed with an
+	//MFA code, the maximum of roles which do not set one, so that the code is
+	//not prompted for every few minutes.
+	mfaRoleDuration = time.Hour
+	//mfaScopePrefix prefixes the role ARN as the cache scope of the session of a
+	//role assumed with an MFA code, which is shared by every repository.
+	mfaScopePrefix = "mfa:"
+)
+
+//assumeRole is a role to assume and the options to assume it with
+type assumeRole struct {
+	arn         string
+	sessionName string
+	externalID  string
+	//duration of the role session, the SDK default when zero
+	duration       time.Duration
+	tags           []*sts.Tag
+	sourceIdentity string
+
+	//mfaSerial is the MFA device the role requires, tokenProvider prompts for its code
+	mfaSerial     string
+	tokenProvider func() (string, error)
+
+	//webIdentity is set if the role is assumed with an OIDC token rather than credentials
+	webIdentity *webIdentityToken
+}
+
+//roleChain are roles assumed in order, each with the credentials of the previous one
+type roleChain []*assumeRole
+
+//addRoleFlags adds the --role-arn flag, and the flags for the options to assume the roles with, to cmd
+func addRoleFlags(cmd *cobra.Command) {
+	f := cmd.Flags()
+	f.StringSlice("role-arn", envList(envKeyCodeCommitRoleARN),
+		fmt.Sprintf(`role to assume when retrieving aws credentials, repeat to assume a chain of roles in order
+Can be set from the environment with %s, comma separated`, envKeyCodeCommitRoleARN))
+	f.StringSlice("role-session-name", envList(envKeyCodeCommitRoleSessionName),
+		fmt.Sprintf(`session name of the assumed role, eg. a CI job ID, one for every role or one per role
+Can be set from the environment with %s, comma separated`, envKeyCodeCommitRoleSessionName))
+	f.StringSlice("external-id", envList(envKeyCodeCommitExternalID),
+		fmt.Sprintf(`external ID required by the role's trust policy, one for every role or one per role
+Can be set from the environment with %s, comma separated`, envKeyCodeCommitExternalID))
+	f.Duration("role-duration", 0,
+		fmt.Sprintf("duration of the role session, eg. 1h (default %v, %v for a role requiring MFA)\nCan be set from the environment with %s",
+			stscreds.DefaultDuration, mfaRoleDuration, envKeyCodeCommitRoleDuration))
+	f.StringSlice("session-tag", envList(envKeyCodeCommitSessionTags),
+		fmt.Sprintf("session tag KEY=VALUE of the role session, may be repeated\nCan be set from the environment with %s, comma separated",
+			envKeyCodeCommitSessionTags))
+	f.String("source-identity", os.Getenv(envKeyCodeCommitSourceIdentity),
+		fmt.Sprintf("source identity of the role session, recorded by CloudTrail\nCan be set from the environment with %s",
+			envKeyCodeCommitSourceIdentity))
+	f.String("mfa-serial", os.Getenv(envKeyCodeCommitMFASerial),
+		fmt.Sprintf(`serial number or ARN of the MFA device required to assume the first role,
+the role session is cached so that the code is only prompted for when it expires
+Can be set from the environment with %s`, envKeyCodeCommitMFASerial))
+	f.String("mfa-askpass", os.Getenv(envKeyCodeCommitMFAAskpass),
+		fmt.Sprintf(`program to prompt for the MFA code with, rather than %s
+Can be set from the environment with %s`, ttyPath, envKeyCodeCommitMFAAskpass))
+	addWebIdentityFlags(f)
+}
+
+//envList return the comma separated values of the environment variable key
+func envList(key string) []string {
+	if env := os.Getenv(key); env != "" {
+		return strings.Split(env, ",")
+	}
+	return nil
+}
+
+//parseRoleChain return the roles set by the flags added by addRoleFlags, nil if no role is set.
+//Session names and external IDs are per role, the other options apply to every role.
+func parseRoleChain(f *pflag.FlagSet) (roleChain, error) {
+	arns, err := f.GetStringSlice("role-arn")
+	if err != nil {
+		return nil, err
+	}
+	webIdentity, err := parseWebIdentityToken(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(arns) == 0 {
+		if mfaSerial, _ := f.GetString("mfa-serial"); mfaSerial != "" {
+			return nil, fmt.Errorf("--mfa-serial requires a role to assume, set --role-arn")
+		}
+		if webIdentity != nil {
+			return nil, fmt.Errorf("a web identity token requires a role to assume, set --role-arn")
+		}
+		return nil, nil
+	}
+	sessionNames, err := perRoleValues(f, "role-session-name", len(arns))
+	if err != nil {
+		return nil, err
+	}
+	externalIDs, err := perRoleValues(f, "external-id", len(arns))
+	if err != nil {
+		return nil, err
+	}
+
+	sourceIdentity, err := f.GetString("source-identity")
+	if err != nil {
+		return nil, err
+	}
+	duration, err := f.GetDuration("role-duration")
+	if err != nil {
+		return nil, err
+	}
+	if env := os.Getenv(envKeyCodeCommitRoleDuration); env != "" && !f.Changed("role-duration") {
+		if duration, err = time.ParseDuration(env); err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %v", envKeyCodeCommitRoleDuration, env, err)
+		}
+	}
+	pairs, err := f.GetStringSlice("session-tag")
+	if err != nil {
+		return nil, err
+	}
+	tags, err := parseSessionTags(pairs)
+	if err != nil {
+		return nil, err
+	}
+	mfaSerial, err := f.GetString("mfa-serial")
+	if err != nil {
+		return nil, err
+	}
+	askpass, err := f.GetString("mfa-askpass")
+	if err != nil {
+		return nil, err
+	}
+
+	chain := make(roleChain, len(arns))
+	for i, arn := range arns {
+		if arn = strings.TrimSpace(arn); arn == "" {
+			return nil, fmt.Errorf("empty role ARN in %q", strings.Join(arns, ","))
+		}
+		chain[i] = &assumeRole{
+			arn:            arn,
+			sessionName:    sessionNames[i],
+			externalID:     externalIDs[i],
+			duration:       duration,
+			tags:           tags,
+			sourceIdentity: sourceIdentity,
+		}
+	}
+	chain[0].webIdentity = webIdentity
+	// later roles are assumed with role credentials, which can not provide an MFA code
+	if mfaSerial != "" {
+		chain[0].mfaSerial = mfaSerial
+		chain[0].tokenProvider = mfaTokenProvider(mfaSerial, askpass)
+	}
+	if err := checkWebIdentityRole(chain[0]); err != nil {
+		return nil, err
+	}
+	return chain, nil
+}
+
+//perRoleValues return the value of the slice flag name for each of n roles,
+//a single value applies to every role. Empty values are left unset.
+func perRoleValues(f *pflag.FlagSet, name string, n int) ([]string, error) {
+	values, err := f.GetStringSlice(name)
+	if err != nil {
+		return nil, err
+	}
+	switch len(values) {
+	case 0:
+		return make([]string, n), nil
+	case 1:
+		all := make([]string, n)
+		for i := range all {
+			all[i] = values[0]
+		}
+		return all, nil
+	case n:
+		return values, nil
+	default:
+		return nil, fmt.Errorf("%d --%s values set for %d roles, set one for every role or one per role",
+			len(values), name, n)
+	}
+}
+
+//parseSessionTags return the STS tags for KEY=VALUE pairs
+func parseSessionTags(pairs []string) ([]*sts.Tag, error) {
+	var tags []*sts.Tag
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid session tag %q, expected KEY=VALUE", pair)
+		}
+		tags = append(tags, &sts.Tag{Key: aws.String(parts[0]), Value: aws.String(parts[1])})
+	}
+	return tags, nil
+}
+
+//provider return the provider assuming the role with the credentials of sess,
+//or with the web identity token if set.
+func (r *assumeRole) provider(sess *session.Session) credentials.Provider {
+	if r.webIdentity != nil {
+		var client stsiface.STSAPI = sts.New(sess)
+		if r.duration != 0 {
+			client = &webIdentityDurationClient{STS: sts.New(sess), duration: r.duration}
+		}
+		return stscreds.NewWebIdentityRoleProviderWithToken(client, r.arn, r.sessionName, r.webIdentity)
+	}
+	return r.assumeRoleProvider(sess)
+}
+
+//assumeRoleProvider return the provider assuming the role with the credentials of sess
+func (r *assumeRole) assumeRoleProvider(sess *session.Session) *stscreds.AssumeRoleProvider {
+	var client stscreds.AssumeRoler = sts.New(sess)
+	if r.sourceIdentity != "" {
+		client = &sourceIdentityClient{STS: sts.New(sess), sourceIdentity: r.sourceIdentity}
+	}
+	p := &stscreds.AssumeRoleProvider{
+		Client:          client,
+		RoleARN:         r.arn,
+		RoleSessionName: r.sessionName,
+		Duration:        r.duration,
+		Tags:            r.tags,
+	}
+	if p.Duration == 0 {
+		p.Duration = stscreds.DefaultDuration
+		if r.mfaSerial != "" {
+			p.Duration = mfaRoleDuration
+		}
+	}
+	if r.externalID != "" {
+		p.ExternalID = aws.String(r.externalID)
+	}
+	if r.mfaSerial != "" {
+		p.SerialNumber = aws.String(r.mfaSerial)
+		p.TokenProvider = r.tokenProvider
+	}
+	return p
+}
+
+//credentials return the credentials of the last role, the first is assumed
+//with the credentials of sess. If cache is not nil the last role's credentials
+//are cached for scope (host/path), and the session of a role assumed with an
+//MFA code for every scope, see mfaScopes, so that the code is only prompted
+//for when it expires. With an empty scope only the MFA sessions are cached.
+func (c roleChain) credentials(sess *session.Session, cache *credentialCache, scope string) (*credentials.Credentials, error) {
+	// cached credentials are encrypted with the secret of the source identity
+	var identity, secret string
+	if cache != nil && c[0].webIdentity != nil {
+		token, err := c[0].webIdentity.FetchToken(aws.BackgroundContext())
+		if err != nil {
+			return nil, err
+		}
+		identity, secret = c[0].webIdentity.source, string(token)
+	} else if cache != nil {
+		source, err := sess.Config.Credentials.Get()
+		if err != nil {
+			return nil, err
+		}
+		identity, secret = source.AccessKeyID, source.SecretAccessKey
+	}
+
+	var p credentials.Provider
+	for i, r := range c {
+		p = r.provider(sess)
+		creds := credentials.NewCredentials(p)
+		if r.mfaSerial != "" && cache != nil {
+			creds = newCachedCredentials(cache, p, identity, secret, r.key(), mfaScopePrefix+r.arn)
+			if i == len(c)-1 {
+				return creds, nil
+			}
+		}
+		sess = sess.Copy(&aws.Config{Credentials: creds})
+	}
+	if cache == nil || scope == "" {
+		return sess.Config.Credentials, nil
+	}
+	return newCachedCredentials(cache, p, identity, secret, c.key(), scope), nil
+}
+
+//mfaScopes return the cache scopes of the sessions of roles assumed with an MFA code
+func (c roleChain) mfaScopes() []string {
+	var scopes []string
+	for _, r := range c {
+		if r.mfaSerial != "" {
+			scopes = append(scopes, mfaScopePrefix+r.arn)
+		}
+	}
+	return scopes
+}
+
+//checkPartition return an error if a role is not in the partition of the CodeCommit endpoint e
+func (c roleChain) checkPartition(e *codecommit.Endpoint) error {
+	for _, r := range c {
+		if err := e.CheckARN(r.arn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//String return the role ARNs in the order they are assumed
+func (c roleChain) String() string {
+	arns := make([]string, len(c))
+	for i, r := range c {
+		arns[i] = r.arn
+	}
+	return strings.Join(arns, " -> ")
+}
+
+func (c roleChain) key() string {
+	keys := make([]string, len(c))
+	for i, r := range c {
+		keys[i] = r.key()
+	}
+	return strings.Join(keys, "\x01")
+}
+
+//key identifies the role and the options which change the session it is assumed with
+func (r *assumeRole) key() string {
+	tags := make([]string, 0, len(r.tags))
+	for _, t := range r.tags {
+		tags = append(tags, aws.StringValue(t.Key)+"="+aws.StringValue(t.Value))
+	}
+	sort.Strings(tags)
+	return strings.Join([]string{
+		r.arn, r.sessionName, r.externalID, r.duration.String(), strings.Join(tags, ","), r.sourceIdentity, r.mfaSerial,
+	}, "\x00")
+}
+
+//sourceIdentityClient is a stscreds.AssumeRoler which sets the SourceIdentity
+//of the role session, a parameter the vendored SDK's AssumeRoleInput lacks.
+type sourceIdentityClient struct {
+	*sts.STS
+	sourceIdentity string
+}
+
+func (c *sourceIdentityClient) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	return c.AssumeRoleWithContext(aws.BackgroundContext(), input)
+}
+
+//AssumeRoleWithContext overrides the embedded client's, which AssumeRoleProvider prefers
+func (c *sourceIdentityClient) AssumeRoleWithContext(ctx aws.Context, input *sts.AssumeRoleInput, opts ...request.Option) (*sts.AssumeRoleOutput, error) {
+	req, out := c.AssumeRoleRequest(input)
+	req.SetContext(ctx)
+	req.ApplyOptions(opts...)
+	req.Handlers.Build.PushBack(c.addSourceIdentity)
+	return out, req.Send()
+}
+
+//addSourceIdentity appends SourceIdentity to the form encoded request body
+func (c *sourceIdentityClient) addSourceIdentity(r *request.Request) {
+	body, err := ioutil.ReadAll(r.GetBody())
+	if err != nil {
+		r.Error = err
+		return
+	}
+	params := nurl.Values{"SourceIdentity": {c.sourceIdentity}}
+	r.SetStringBody(string(body) + "&" + params.Encode())
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/spf13/cobra"
+)
+
+const assumeRoleResponse = `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>ROLESECRET</SecretAccessKey>
+      <SessionToken>ROLETOKEN</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`
+
+// TestParseRoleChain tests that the roles and their options are read from flags.
+func TestParseRoleChain(t *testing.T) {
+	cmd := &cobra.Command{}
+	addRoleFlags(cmd)
+	err := cmd.Flags().Parse([]string{
+		"--role-arn", "arn:aws:iam::111111111111:role/pipeline",
+		"--role-arn", "arn:aws:iam::222222222222:role/git",
+		"--role-session-name", "job-42",
+		"--external-id", ",EXTERNAL",
+		"--role-duration", "1h",
+		"--session-tag", "team=ops,job=42",
+		"--session-tag", "env=ci",
+	})
+	if err != nil {
+		t.Fatalf("Failed to parse flags, err=%v", err)
+	}
+
+	chain, err := parseRoleChain(cmd.Flags())
+	if err != nil {
+		t.Fatalf("Failed to parse roles, err=%v", err)
+	}
+	if len(chain) != 2 {
+		t.Fatalf("Expected 2 roles, actual %v", chain)
+	}
+	if r := chain[0]; r.arn != "arn:aws:iam::111111111111:role/pipeline" || r.sessionName != "job-42" ||
+		r.externalID != "" || r.duration != time.Hour {
+		t.Errorf("Unexpected first role %+v", r)
+	}
+	if r := chain[1]; r.arn != "arn:aws:iam::222222222222:role/git" || r.sessionName != "job-42" ||
+		r.externalID != "EXTERNAL" || r.duration != time.Hour {
+		t.Errorf("Unexpected second role %+v", r)
+	}
+	if tags := chain[1].tags; len(tags) != 3 || aws.StringValue(tags[2].Key) != "env" || aws.StringValue(tags[2].Value) != "ci" {
+		t.Errorf("Unexpected session tags %v", tags)
+	}
+	if actual, expected := chain.String(), "arn:aws:iam::111111111111:role/pipeline -> arn:aws:iam::222222222222:role/git"; actual != expected {
+		t.Errorf("Expected %q, actual %q", expected, actual)
+	}
+
+	if _, err := parseSessionTags([]string{"no-value"}); err == nil {
+		t.Errorf("Expected error for session tag without a value")
+	}
+
+	cmd = &cobra.Command{}
+	addRoleFlags(cmd)
+	cmd.Flags().Parse([]string{"--role-arn", "a,b,c", "--external-id", "x,y"})
+	if _, err := parseRoleChain(cmd.Flags()); err == nil {
+		t.Errorf("Expected error for 2 external IDs for 3 roles")
+	}
+
+	cmd = &cobra.Command{}
+	addRoleFlags(cmd)
+	if chain, err := parseRoleChain(cmd.Flags()); chain != nil || err != nil {
+		t.Errorf("Expected no roles, actual %v, err=%v", chain, err)
+	}
+}
+
+// TestAssumeRoleOptions tests that the role options, including the source identity, are sent to STS.
+func TestAssumeRoleOptions(t *testing.T) {
+	var form url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		fmt.Fprintf(w, assumeRoleResponse, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session, err=%v", err)
+	}
+	tags, _ := parseSessionTags([]string{"team=ops"})
+	r := &assumeRole{
+		arn:            "arn:aws:iam::123456789012:role/git",
+		sessionName:    "job-42",
+		externalID:     "EXTERNAL",
+		duration:       time.Hour,
+		tags:           tags,
+		sourceIdentity: "alice",
+	}
+
+	creds, err := roleChain{r}.credentials(sess, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create credentials, err=%v", err)
+	}
+	v, err := creds.Get()
+	if err != nil {
+		t.Fatalf("Failed to assume role, err=%v", err)
+	}
+	if v.AccessKeyID != "ASIAROLE" {
+		t.Errorf("Expected role credentials, actual %v", v.AccessKeyID)
+	}
+
+	expected := map[string]string{
+		"Action":              "AssumeRole",
+		"RoleArn":             r.arn,
+		"RoleSessionName":     "job-42",
+		"ExternalId":          "EXTERNAL",
+		"DurationSeconds":     "3600",
+		"Tags.member.1.Key":   "team",
+		"Tags.member.1.Value": "ops",
+		"SourceIdentity":      "alice",
+	}
+	for key, value := range expected {
+		if actual := form.Get(key); actual != value {
+			t.Errorf("Expected %s=%q, actual %q", key, value, actual)
+		}
+	}
+}
+
+// TestRoleChainCredentials tests that each role is assumed with the credentials of the previous one.
+func TestRoleChainCredentials(t *testing.T) {
+	var signers []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if i := strings.Index(auth, "Credential="); i >= 0 {
+			signers = append(signers, strings.SplitN(auth[i+len("Credential="):], "/", 2)[0])
+		}
+		fmt.Fprintf(w, assumeRoleResponse, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session, err=%v", err)
+	}
+	chain := roleChain{
+		{arn: "arn:aws:iam::111111111111:role/pipeline"},
+		{arn: "arn:aws:iam::222222222222:role/git"},
+	}
+	creds, err := chain.credentials(sess, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create credentials, err=%v", err)
+	}
+	if _, err := creds.Get(); err != nil {
+		t.Fatalf("Failed to assume roles, err=%v", err)
+	}
+	if len(signers) != 2 || signers[0] != "AKID" || signers[1] != "ASIAROLE" {
+		t.Errorf("Expected roles assumed with AKID then ASIAROLE, actual %v", signers)
+	}
+}
+
+// TestMFARoleCredentialsShared tests that the session of a role assumed with an MFA code is shared by every repository.
+func TestMFARoleCredentialsShared(t *testing.T) {
+	calls := 0
+	var mfaDuration string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.FormValue("SerialNumber") != "" {
+			mfaDuration = r.FormValue("DurationSeconds")
+		}
+		fmt.Fprintf(w, assumeRoleResponse, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+	cache, cleanup := newTestCache(t)
+	defer cleanup()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(server.URL),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session, err=%v", err)
+	}
+	prompts := 0
+	for _, chain := range []roleChain{
+		{{arn: "arn:aws:iam::111111111111:role/mfa", mfaSerial: "arn:aws:iam::111111111111:mfa/me"}},
+		{{arn: "arn:aws:iam::111111111111:role/mfa", mfaSerial: "arn:aws:iam::111111111111:mfa/me"}, {arn: "arn:aws:iam::222222222222:role/git"}},
+	} {
+		chain[0].tokenProvider = func() (string, error) {
+			prompts++
+			return "123456", nil
+		}
+		for _, scope := range []string{
+			"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/a",
+			"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/b",
+		} {
+			creds, err := chain.credentials(sess, cache, scope)
+			if err != nil {
+				t.Fatalf("Failed to create credentials, err=%v", err)
+			}
+			if _, err := creds.Get(); err != nil {
+				t.Fatalf("Failed to assume roles, err=%v", err)
+			}
+		}
+	}
+	// the MFA role is assumed once, and the second role of the chain once per repository
+	if prompts != 1 || calls != 3 {
+		t.Errorf("Expected 1 MFA prompt and 3 AssumeRole calls, actual %d and %d", prompts, calls)
+	}
+	if mfaDuration != "3600" {
+		t.Errorf("Expected an MFA role session of 3600 seconds, actual %q", mfaDuration)
+	}
+
+	// a rejected session of the MFA role is erased
+	chain := roleChain{{arn: "arn:aws:iam::111111111111:role/mfa", mfaSerial: "arn:aws:iam::111111111111:mfa/me"}}
+	for _, scope := range chain.mfaScopes() {
+		if err := cache.erase(scope); err != nil {
+			t.Fatalf("Failed to erase the MFA session, err=%v", err)
+		}
+	}
+	if keys, err := cache.keys(); err != nil || len(keys) != 2 {
+		t.Errorf("Expected only the entries of the repositories to remain, actual %v, err=%v", keys, err)
+	}
+}
+
+// TestProfileRoleCredentials tests that the first role is assumed with the credentials of the profile.
+func TestProfileRoleCredentials(t *testing.T) {
+	var signer string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if i := strings.Index(auth, "Credential="); i >= 0 {
+			signer = strings.SplitN(auth[i+len("Credential="):], "/", 2)[0]
+		}
+		fmt.Fprintf(w, assumeRoleResponse, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "TestProfileRoleCredentials-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "credentials")
+	err = ioutil.WriteFile(file, []byte("[dev]\naws_access_key_id = AKIDDEV\naws_secret_access_key = SECRET\n"), 0600)
+	if err != nil {
+		t.Fatalf("Failed to write credentials, err=%v", err)
+	}
+	os.Setenv("AWS_SHARED_CREDENTIALS_FILE", file)
+	defer os.Unsetenv("AWS_SHARED_CREDENTIALS_FILE")
+	os.Setenv(envKeyAwsConfigFile, filepath.Join(dir, "config"))
+	defer os.Unsetenv(envKeyAwsConfigFile)
+
+	sess, err := newSession(&aws.Config{Region: aws.String("us-east-1"), Endpoint: aws.String(server.URL)}, "dev", nil)
+	if err != nil {
+		t.Fatalf("Failed to create session, err=%v", err)
+	}
+	creds, err := roleChain{{arn: "arn:aws:iam::123456789012:role/git"}}.credentials(sess, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create credentials, err=%v", err)
+	}
+	if v, err := creds.Get(); err != nil || v.AccessKeyID != "ASIAROLE" {
+		t.Fatalf("Failed to assume role, actual %v, err=%v", v.AccessKeyID, err)
+	}
+	if signer != "AKIDDEV" {
+		t.Errorf("Expected role assumed with the profile's AKIDDEV, actual %q", signer)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	nurl "net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	envKeyAwsConfigFile     = "AWS_CONFIG_FILE"
+	envKeyAwsDefaultProfile = "AWS_DEFAULT_PROFILE"
+	envKeyAwsAccessKeyID    = "AWS_ACCESS_KEY_ID"
+
+	ssoProviderName        = "SSOProvider"
+	ssoErrCodeTokenExpired = "SSOTokenExpired"
+	ssoErrCodeInvalid      = "SSOProviderInvalidToken"
+)
+
+//ssoProfile is an AWS IAM Identity Center (SSO) profile of the shared config,
+//in either the sso-session or the legacy form:
+//	[profile dev]
+//	sso_session = my-sso
+//	sso_account_id = 123456789012
+//	sso_role_name = Developer
+//	[sso-session my-sso]
+//	sso_start_url = https://my-sso.awsapps.com/start
+//	sso_region = us-east-1
+type ssoProfile struct {
+	name      string
+	session   string
+	startURL  string
+	region    string
+	accountID string
+	roleName  string
+}
+
+//tokenCacheKey return the key the AWS CLI caches the profile's access token under
+func (p *ssoProfile) tokenCacheKey() string {
+	key := p.startURL
+	if p.session != "" {
+		key = p.session
+	}
+	sum := sha1.Sum([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+//loginCommand return the AWS CLI command which refreshes the profile's access token
+func (p *ssoProfile) loginCommand() string {
+	if p.name == "default" {
+		return "aws sso login"
+	}
+	return "aws sso login --profile " + p.name
+}
+
+//sharedConfigFile return the path of the AWS shared config file
+func sharedConfigFile() string {
+	if path := os.Getenv(envKeyAwsConfigFile); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", "config")
+}
+
+//parseINI return the key/values of each section of an AWS shared config file
+func parseINI(r io.Reader) (map[string]map[string]string, error) {
+	sections := map[string]map[string]string{}
+	var section map[string]string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			if section = sections[name]; section == nil {
+				section = map[string]string{}
+				sections[name] = section
+			}
+		case section != nil && strings.Contains(line, "="):
+			parts := strings.SplitN(line, "=", 2)
+			section[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	return sections, s.Err()
+}
+
+//loadSSOProfile return the SSO settings of profile, nil if it is not an SSO profile
+func loadSSOProfile(path, profile string) (*ssoProfile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	sections, err := parseINI(f)
+	if err != nil {
+		return nil, err
+	}
+
+	name := "profile " + profile
+	if profile == "default" && sections[name] == nil {
+		name = "default"
+	}
+	values := sections[name]
+	if values["sso_account_id"] == "" && values["sso_session"] == "" && values["sso_start_url"] == "" {
+		return nil, nil
+	}
+
+	p := &ssoProfile{
+		name:      profile,
+		session:   values["sso_session"],
+		startURL:  values["sso_start_url"],
+		region:    values["sso_region"],
+		accountID: values["sso_account_id"],
+		roleName:  values["sso_role_name"],
+	}
+	if p.session != "" {
+		s, ok := sections["sso-session "+p.session]
+		if !ok {
+			return nil, fmt.Errorf("sso-session %q of AWS profile %q not found in %s", p.session, profile, path)
+		}
+		p.startURL, p.region = s["sso_start_url"], s["sso_region"]
+	}
+	if p.startURL == "" || p.region == "" || p.accountID == "" || p.roleName == "" {
+		return nil, fmt.Errorf("AWS profile %q is missing sso_start_url, sso_region, sso_account_id or sso_role_name", profile)
+	}
+	return p, nil
+}
+
+//ssoToken is an access token cached by aws sso login
+type ssoToken struct {
+	AccessToken string `json:"accessToken"`
+	ExpiresAt   string `json:"expiresAt"`
+}
+
+//expiry return when the token expires, older CLI versions use a "UTC" suffix
+func (t *ssoToken) expiry() (time.Time, error) {
+	if expiry, err := time.Parse(time.RFC3339, t.ExpiresAt); err == nil {
+		return expiry, nil
+	}
+	return time.Parse("2006-01-02T15:04:05UTC", t.ExpiresAt)
+}
+
+//ssoProvider is a credentials.Provider for the role of an SSO profile, using
+//the access token cached by aws sso login.
+type ssoProvider struct {
+	credentials.Expiry
+
+	profile *ssoProfile
+	//tokenDir is where aws sso login caches access tokens
+	tokenDir string
+	//endpoint overrides the SSO portal URL
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+}
+
+func newSSOProvider(profile *ssoProfile) (*ssoProvider, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return &ssoProvider{
+		profile:  profile,
+		tokenDir: filepath.Join(home, ".aws", "sso", "cache"),
+		client:   http.DefaultClient,
+		now:      time.Now,
+	}, nil
+}
+
+func (p *ssoProvider) expiredError(reason string) error {
+	return awserr.New(ssoErrCodeTokenExpired,
+		fmt.Sprintf("the SSO session of AWS profile %q %s, run %q", p.profile.name, reason, p.profile.loginCommand()), nil)
+}
+
+//token return the cached access token, if it has not expired
+func (p *ssoProvider) token() (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(p.tokenDir, p.profile.tokenCacheKey()+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", p.expiredError("has no cached access token")
+		}
+		return "", err
+	}
+	t := &ssoToken{}
+	if err := json.Unmarshal(data, t); err != nil {
+		return "", awserr.New(ssoErrCodeInvalid, "invalid cached SSO access token", err)
+	}
+	expiry, err := t.expiry()
+	if err != nil {
+		return "", awserr.New(ssoErrCodeInvalid, "invalid cached SSO access token expiry", err)
+	}
+	if t.AccessToken == "" || !p.now().Before(expiry) {
+		return "", p.expiredError("has expired")
+	}
+	return t.AccessToken, nil
+}
+
+func (p *ssoProvider) portalURL() (string, error) {
+	if p.endpoint != "" {
+		return p.endpoint, nil
+	}
+	partition, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), p.profile.region)
+	if !ok {
+		return "", fmt.Errorf("unknown sso_region %q of AWS profile %q", p.profile.region, p.profile.name)
+	}
+	return fmt.Sprintf("https://portal.sso.%s.%s", p.profile.region, partition.DNSSuffix()), nil
+}
+
+//Retrieve calls the SSO portal GetRoleCredentials API with the cached access token
+func (p *ssoProvider) Retrieve() (credentials.Value, error) {
+	token, err := p.token()
+	if err != nil {
+		return credentials.Value{ProviderName: ssoProviderName}, err
+	}
+	portal, err := p.portalURL()
+	if err != nil {
+		return credentials.Value{ProviderName: ssoProviderName}, err
+	}
+
+	query := nurl.Values{"account_id": {p.profile.accountID}, "role_name": {p.profile.roleName}}
+	req, err := http.NewRequest(http.MethodGet, portal+"/federation/credentials?"+query.Encode(), nil)
+	if err != nil {
+		return credentials.Value{ProviderName: ssoProviderName}, err
+	}
+	req.Header.Set("x-amz-sso_bearer_token", token)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return credentials.Value{ProviderName: ssoProviderName}, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		return credentials.Value{ProviderName: ssoProviderName}, p.expiredError("is no longer valid")
+	case resp.StatusCode != http.StatusOK:
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return credentials.Value{ProviderName: ssoProviderName}, fmt.Errorf(
+			"SSO GetRoleCredentials for role %q of account %s failed: %s %s",
+			p.profile.roleName, p.profile.accountID, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var out struct {
+		RoleCredentials struct {
+			AccessKeyID     string `json:"accessKeyId"`
+			SecretAccessKey string `json:"secretAccessKey"`
+			SessionToken    string `json:"sessionToken"`
+			Expiration      int64  `json:"expiration"`
+		} `json:"roleCredentials"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return credentials.Value{ProviderName: ssoProviderName}, err
+	}
+	rc := out.RoleCredentials
+	p.SetExpiration(time.Unix(0, rc.Expiration*int64(time.Millisecond)), 0)
+	return credentials.Value{
+		AccessKeyID:     rc.AccessKeyID,
+		SecretAccessKey: rc.SecretAccessKey,
+		SessionToken:    rc.SessionToken,
+		ProviderName:    ssoProviderName,
+	}, nil
+}
+
+//setSSOCredentials sets the credentials of sess to those of the SSO profile,
+//if profile is one, cached in cache if it is not nil. When profile is not set
+//the AWS_PROFILE profile is used, unless credentials are set in the environment.
+func setSSOCredentials(sess *session.Session, profile string, cache *credentialCache) error {
+	if profile == "" {
+		if os.Getenv(envKeyAwsAccessKeyID) != "" {
+			return nil
+		}
+		profile = os.Getenv(envKeyAwsProfile)
+	}
+	if profile == "" {
+		profile = os.Getenv(envKeyAwsDefaultProfile)
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	p, err := loadSSOProfile(sharedConfigFile(), profile)
+	if err != nil || p == nil {
+		return err
+	}
+	provider, err := newSSOProvider(p)
+	if err != nil {
+		return err
+	}
+
+	// cached credentials are encrypted with the SSO access token
+	token, err := provider.token()
+	if cache == nil || err != nil {
+		sess.Config.Credentials = credentials.NewCredentials(provider)
+		return nil
+	}
+	sess.Config.Credentials = newCachedCredentials(cache, provider, p.startURL, token, p.accountID+"/"+p.roleName, "")
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const ssoConfig = `[default]
+region = us-east-1
+
+[profile legacy]
+sso_start_url = https://legacy.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 111111111111
+sso_role_name = Developer
+
+[profile dev]
+sso_session = my-sso
+sso_account_id = 222222222222
+sso_role_name = ReadOnly
+
+[sso-session my-sso]
+sso_start_url = https://my-sso.awsapps.com/start
+sso_region = eu-west-1
+
+[profile broken]
+sso_session = missing
+sso_account_id = 222222222222
+sso_role_name = ReadOnly
+`
+
+func writeSSOConfig(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, "config")
+	if err := ioutil.WriteFile(path, []byte(ssoConfig), 0600); err != nil {
+		t.Fatalf("Failed to write config, err=%v", err)
+	}
+	return path
+}
+
+// TestLoadSSOProfile tests that both forms of SSO profile are read from the shared config.
+func TestLoadSSOProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestLoadSSOProfile-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeSSOConfig(t, dir)
+
+	tests := []struct {
+		profile  string
+		expected *ssoProfile
+	}{
+		{"default", nil},
+		{"missing", nil},
+		{"legacy", &ssoProfile{"legacy", "", "https://legacy.awsapps.com/start", "us-east-1", "111111111111", "Developer"}},
+		{"dev", &ssoProfile{"dev", "my-sso", "https://my-sso.awsapps.com/start", "eu-west-1", "222222222222", "ReadOnly"}},
+	}
+	for _, test := range tests {
+		actual, err := loadSSOProfile(path, test.profile)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.profile, err)
+			continue
+		}
+		if (actual == nil) != (test.expected == nil) || (actual != nil && *actual != *test.expected) {
+			t.Errorf("%s: expected %+v, actual %+v", test.profile, test.expected, actual)
+		}
+	}
+
+	if _, err := loadSSOProfile(path, "broken"); err == nil {
+		t.Errorf("Expected error for missing sso-session")
+	}
+}
+
+// TestSSOProvider tests that role credentials are retrieved with the cached access token.
+func TestSSOProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestSSOProvider-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	expiration := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-amz-sso_bearer_token") != "valid" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if q := r.URL.Query(); r.URL.Path != "/federation/credentials" ||
+			q.Get("account_id") != "222222222222" || q.Get("role_name") != "ReadOnly" {
+			t.Errorf("Unexpected request %v", r.URL)
+		}
+		fmt.Fprintf(w, `{"roleCredentials":{"accessKeyId":"ASIASSO","secretAccessKey":"SECRET","sessionToken":"TOKEN","expiration":%d}}`,
+			expiration.UnixNano()/int64(time.Millisecond))
+	}))
+	defer server.Close()
+
+	profile := &ssoProfile{"dev", "my-sso", "https://my-sso.awsapps.com/start", "eu-west-1", "222222222222", "ReadOnly"}
+	p := &ssoProvider{profile: profile, tokenDir: dir, endpoint: server.URL, client: server.Client(), now: time.Now}
+	writeToken := func(token string, expiresAt string) {
+		t.Helper()
+		data := fmt.Sprintf(`{"accessToken":%q,"expiresAt":%q}`, token, expiresAt)
+		if err := ioutil.WriteFile(filepath.Join(dir, profile.tokenCacheKey()+".json"), []byte(data), 0600); err != nil {
+			t.Fatalf("Failed to write token, err=%v", err)
+		}
+	}
+	assertExpired := func() {
+		t.Helper()
+		_, err := p.Retrieve()
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != ssoErrCodeTokenExpired {
+			t.Errorf("Expected %s, actual %v", ssoErrCodeTokenExpired, err)
+		}
+	}
+
+	assertExpired()
+
+	writeToken("valid", time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	v, err := p.Retrieve()
+	if err != nil {
+		t.Fatalf("Failed to retrieve credentials, err=%v", err)
+	}
+	if v.AccessKeyID != "ASIASSO" || v.SessionToken != "TOKEN" {
+		t.Errorf("Unexpected credentials %v", v)
+	}
+	if !p.ExpiresAt().Equal(expiration) {
+		t.Errorf("Expected expiration %v, actual %v", expiration, p.ExpiresAt())
+	}
+
+	writeToken("valid", time.Now().Add(-time.Minute).UTC().Format("2006-01-02T15:04:05UTC"))
+	assertExpired()
+
+	writeToken("revoked", time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	assertExpired()
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+
+	"github.com/InteleradMedicalSystems/go-codecommit/pkg/codecommit"
+)
+
+const (
+	//watchRetryMin and watchRetryMax bound the delay between retries of failed refreshes
+	watchRetryMin = 5 * time.Second
+	watchRetryMax = time.Minute
+	//watchRefreshMin is the least delay between refreshes, for credentials about to expire
+	watchRefreshMin = 10 * time.Second
+)
+
+//fileRepository is a repository whose credentials are written to a credentialFile
+type fileRepository struct {
+	*CodeCommitCredentials
+	url string
+}
+
+//credentialFile writes the credentials of repositories to a file, refreshed
+//before they expire when watched.
+type credentialFile struct {
+	//path of the file, stdout if empty
+	path string
+	//readyPath is created once the file is written, and removed when its credentials expire
+	readyPath string
+	write     outputFunc
+	//perHost is set for formats with a single entry per host, eg. netrc
+	perHost bool
+	repos   []*fileRepository
+	now     func() time.Time
+}
+
+//newCredentialFile return the credentialFile for the repositories refs, or
+//the url flag if refs is empty, configured from flags.
+func newCredentialFile(f *pflag.FlagSet, refs []string, write outputFunc) (*credentialFile, error) {
+	cf := &credentialFile{write: write, now: time.Now}
+	var err error
+	if cf.path, err = f.GetString("output-file"); err != nil {
+		return nil, err
+	}
+	if cf.readyPath, err = f.GetString("ready-file"); err != nil {
+		return nil, err
+	}
+	output, err := f.GetString("output")
+	if err != nil {
+		return nil, err
+	}
+	format, err := f.GetString("template")
+	if err != nil {
+		return nil, err
+	}
+	cf.perHost = format == "" && output == "netrc"
+	if len(refs) > 1 && format == "" && output != "netrc" && output != "url" && output != "git-credentials" {
+		return nil, fmt.Errorf("the %s output is for a single URL, use git-credentials or netrc for several", output)
+	}
+
+	if len(refs) == 0 {
+		ref, err := f.GetString("url")
+		if err != nil {
+			return nil, err
+		}
+		if ref == "" {
+			return nil, fmt.Errorf("URL not specified")
+		}
+		refs = []string{ref}
+	}
+	restore := saveFlags(f)
+	for _, ref := range refs {
+		r := &fileRepository{CodeCommitCredentials: &CodeCommitCredentials{}}
+		r.url, err = r.configureRepository(f, ref)
+		restore()
+		if err != nil {
+			return nil, err
+		}
+		cf.repos = append(cf.repos, r)
+	}
+	return cf, nil
+}
+
+//render return the contents of the file, and when the first of its credentials expire
+func (cf *credentialFile) render() ([]byte, time.Time, error) {
+	var b bytes.Buffer
+	var expiry time.Time
+	hosts := map[string]string{}
+	for _, r := range cf.repos {
+		values, err := r.values(r.url)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("%s: %v", r.url, r.describeError(err))
+		}
+		if other, ok := hosts[values.Host]; ok && cf.perHost {
+			return nil, time.Time{}, fmt.Errorf("%s and %s are both on %s, entries are per host but CodeCommit passwords are per repository",
+				other, r.url, values.Host)
+		}
+		hosts[values.Host] = r.url
+		if err := cf.write(&b, values); err != nil {
+			return nil, time.Time{}, err
+		}
+		if expiry.IsZero() || values.Expiry.Before(expiry) {
+			expiry = values.Expiry
+		}
+	}
+	return b.Bytes(), expiry, nil
+}
+
+//update writes the file and return when its credentials expire
+func (cf *credentialFile) update() (time.Time, error) {
+	data, expiry, err := cf.render()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if cf.path == "" {
+		_, err := os.Stdout.Write(data)
+		return expiry, err
+	}
+	if err := os.MkdirAll(filepath.Dir(cf.path), 0700); err != nil {
+		return time.Time{}, err
+	}
+	if err := writeFileAtomic(cf.path, data, 0600); err != nil {
+		return time.Time{}, err
+	}
+	if cf.readyPath != "" {
+		ready := []byte(expiry.UTC().Format(time.RFC3339) + "\n")
+		if err := ioutil.WriteFile(cf.readyPath, ready, 0644); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return expiry, nil
+}
+
+//notReady removes the readiness file
+func (cf *credentialFile) notReady() {
+	if cf.readyPath != "" {
+		os.Remove(cf.readyPath)
+	}
+}
+
+//next return how long to wait before refreshing credentials expiring at
+//expiry, so that they are replaced while they are still accepted.
+func (cf *credentialFile) next(expiry time.Time) time.Duration {
+	wait := expiry.Add(-codecommit.CredentialRefreshWindow).Sub(cf.now())
+	if wait < watchRefreshMin {
+		return watchRefreshMin
+	}
+	return wait
+}
+
+//watch keeps the file refreshed until stop receives. Failed refreshes are
+//retried until the credentials of the file expire, when an error is returned.
+func (cf *credentialFile) watch(stop <-chan os.Signal) error {
+	defer cf.notReady()
+	var expiry time.Time
+	retry := watchRetryMin
+	for {
+		var wait time.Duration
+		next, err := cf.update()
+		switch {
+		case err == nil:
+			expiry, retry = next, watchRetryMin
+			wait = cf.next(expiry)
+			log.Infof("credentials written to %s, refreshing in %s", cf.path, wait.Round(time.Second))
+		case expiry.IsZero():
+			return fmt.Errorf("writing credentials to %s failed: %v", cf.path, err)
+		case !cf.now().Before(expiry):
+			return fmt.Errorf("refreshing credentials failed and the written credentials have expired: %v", err)
+		default:
+			wait, retry = retry, retry*2
+			if retry > watchRetryMax {
+				retry = watchRetryMax
+			}
+			log.Warnf("refreshing credentials failed, retrying in %s: %v", wait, err)
+		}
+
+		select {
+		case <-time.After(wait):
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+//executeCredentialFile writes the credentials of refs, continuously if the watch flag is set
+func executeCredentialFile(f *pflag.FlagSet, refs []string, write outputFunc) error {
+	watch, err := f.GetBool("watch")
+	if err != nil {
+		return err
+	}
+	file, err := f.GetString("output-file")
+	if err != nil {
+		return err
+	}
+	if watch && file == "" {
+		return fmt.Errorf("--watch requires --output-file")
+	}
+	cf, err := newCredentialFile(f, refs, write)
+	if err != nil {
+		return err
+	}
+	if !watch {
+		_, err := cf.update()
+		return err
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	return cf.watch(stop)
+}
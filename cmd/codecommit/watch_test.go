@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func newTestFileRepository(url string, creds *credentials.Credentials) *fileRepository {
+	sess := session.Must(session.NewSession(&aws.Config{Region: aws.String("us-east-1"), Credentials: creds}))
+	return &fileRepository{CodeCommitCredentials: &CodeCommitCredentials{sess: sess}, url: url}
+}
+
+// TestCredentialFileRender tests that the credentials of several repositories are written together.
+func TestCredentialFileRender(t *testing.T) {
+	creds := credentials.NewStaticCredentials("AKID", "SECRET", "")
+	cf := &credentialFile{
+		write: outputs["git-credentials"],
+		repos: []*fileRepository{
+			newTestFileRepository("https://git-codecommit.us-east-1.amazonaws.com/v1/repos/a", creds),
+			newTestFileRepository("https://git-codecommit.us-east-1.amazonaws.com/v1/repos/b", creds),
+		},
+		now: time.Now,
+	}
+	data, expiry, err := cf.render()
+	if err != nil {
+		t.Fatalf("Failed to render, err=%v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "https://AKID:") || !strings.HasSuffix(lines[1], "/v1/repos/b") {
+		t.Errorf("Unexpected git-credentials %q", data)
+	}
+	if until := time.Until(expiry); until <= 0 || until > 15*time.Minute {
+		t.Errorf("Unexpected expiry %v", expiry)
+	}
+
+	cf.write, cf.perHost = outputs["netrc"], true
+	if _, _, err := cf.render(); err == nil {
+		t.Errorf("Expected error for two repositories on the same host in netrc")
+	}
+
+	now := time.Date(2020, 8, 1, 12, 0, 0, 0, time.UTC)
+	cf.now = func() time.Time { return now }
+	if actual := cf.next(now.Add(15 * time.Minute)); actual != 10*time.Minute {
+		t.Errorf("Expected refresh in 10m, actual %v", actual)
+	}
+	if actual := cf.next(now.Add(time.Minute)); actual != watchRefreshMin {
+		t.Errorf("Expected refresh in %v, actual %v", watchRefreshMin, actual)
+	}
+}
+
+// TestCredentialFileWatch tests that the file and readiness file are written, and the readiness file removed on stop.
+func TestCredentialFileWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "TestCredentialFileWatch-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	cf := &credentialFile{
+		path:      filepath.Join(dir, "creds", "git-credentials"),
+		readyPath: filepath.Join(dir, "ready"),
+		write:     outputs["git-credentials"],
+		repos: []*fileRepository{newTestFileRepository("https://git-codecommit.us-east-1.amazonaws.com/v1/repos/a",
+			credentials.NewStaticCredentials("AKID", "SECRET", ""))},
+		now: time.Now,
+	}
+	stop := make(chan os.Signal)
+	done := make(chan error, 1)
+	go func() { done <- cf.watch(stop) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(cf.readyPath); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Readiness file was not written")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	info, err := os.Stat(cf.path)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected credentials file with mode 0600, actual %v, err=%v", info, err)
+	}
+
+	stop <- os.Interrupt
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := os.Stat(cf.readyPath); !os.IsNotExist(err) {
+		t.Errorf("Expected readiness file to be removed, err=%v", err)
+	}
+
+	cf.repos = []*fileRepository{newTestFileRepository(cf.repos[0].url,
+		credentials.NewCredentials(&credentials.ErrorProvider{Err: fmt.Errorf("no credentials"), ProviderName: "test"}))}
+	if err := cf.watch(stop); err == nil {
+		t.Errorf("Expected error when the credentials can not be written")
+	}
+}
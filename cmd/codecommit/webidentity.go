@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/pflag"
+)
+
+const (
+	envKeyCodeCommitWebIdentityTokenFile = "CODECOMMIT_WEB_IDENTITY_TOKEN_FILE"
+	envKeyCodeCommitWebIdentityTokenEnv  = "CODECOMMIT_WEB_IDENTITY_TOKEN_ENV"
+)
+
+//webIdentityToken is the source of the OIDC token the first role is assumed
+//with, the token is read each time the role is assumed so that tokens
+//rotated by the CI system or kubelet are picked up.
+type webIdentityToken struct {
+	stscreds.TokenFetcher
+	//source describes where the token is read from
+	source string
+}
+
+//fetchTokenEnv is a stscreds.TokenFetcher reading the token from an environment variable
+type fetchTokenEnv string
+
+func (e fetchTokenEnv) FetchToken(ctx credentials.Context) ([]byte, error) {
+	token := strings.TrimSpace(os.Getenv(string(e)))
+	if token == "" {
+		return nil, fmt.Errorf("web identity token environment variable %s is not set", string(e))
+	}
+	return []byte(token), nil
+}
+
+//addWebIdentityFlags adds the flags for the web identity token to f
+func addWebIdentityFlags(f *pflag.FlagSet) {
+	f.String("web-identity-token-file", os.Getenv(envKeyCodeCommitWebIdentityTokenFile),
+		fmt.Sprintf(`file containing an OIDC token to assume the first role with, using AssumeRoleWithWebIdentity
+Can be set from the environment with %s`, envKeyCodeCommitWebIdentityTokenFile))
+	f.String("web-identity-token-env", os.Getenv(envKeyCodeCommitWebIdentityTokenEnv),
+		fmt.Sprintf(`environment variable containing an OIDC token to assume the first role with
+Can be set from the environment with %s`, envKeyCodeCommitWebIdentityTokenEnv))
+}
+
+//parseWebIdentityToken return the web identity token source set by flags, nil if none is set
+func parseWebIdentityToken(f *pflag.FlagSet) (*webIdentityToken, error) {
+	file, err := f.GetString("web-identity-token-file")
+	if err != nil {
+		return nil, err
+	}
+	env, err := f.GetString("web-identity-token-env")
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case file != "" && env != "":
+		return nil, fmt.Errorf("only one of web identity token file or environment variable should be set")
+	case file != "":
+		return &webIdentityToken{stscreds.FetchTokenPath(file), "file:" + file}, nil
+	case env != "":
+		return &webIdentityToken{fetchTokenEnv(env), "env:" + env}, nil
+	}
+	return nil, nil
+}
+
+//checkWebIdentityRole return an error if r is assumed with a web identity
+//token and sets options AssumeRoleWithWebIdentity does not accept.
+func checkWebIdentityRole(r *assumeRole) error {
+	if r.webIdentity == nil {
+		return nil
+	}
+	var options []string
+	if r.externalID != "" {
+		options = append(options, "an external ID")
+	}
+	if len(r.tags) > 0 {
+		options = append(options, "session tags")
+	}
+	if r.sourceIdentity != "" {
+		options = append(options, "a source identity")
+	}
+	if r.mfaSerial != "" {
+		options = append(options, "an MFA device")
+	}
+	if len(options) > 0 {
+		return fmt.Errorf("%s can not be set for role %s, which is assumed with a web identity token",
+			strings.Join(options, ", "), r.arn)
+	}
+	return nil
+}
+
+//webIdentityDurationClient sets the duration of AssumeRoleWithWebIdentity
+//sessions, which the vendored SDK's WebIdentityRoleProvider lacks.
+type webIdentityDurationClient struct {
+	*sts.STS
+	duration time.Duration
+}
+
+func (c *webIdentityDurationClient) AssumeRoleWithWebIdentityRequest(input *sts.AssumeRoleWithWebIdentityInput) (*request.Request, *sts.AssumeRoleWithWebIdentityOutput) {
+	input.DurationSeconds = aws.Int64(int64(c.duration / time.Second))
+	return c.STS.AssumeRoleWithWebIdentityRequest(input)
+}
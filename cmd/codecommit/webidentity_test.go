@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+const assumeRoleWithWebIdentityResponse = `<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIAWEB</AccessKeyId>
+      <SecretAccessKey>WEBSECRET</SecretAccessKey>
+      <SessionToken>WEBTOKEN</SessionToken>
+      <Expiration>%s</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`
+
+// TestWebIdentityCredentials tests that the role is assumed for the duration with the current token from the token file.
+func TestWebIdentityCredentials(t *testing.T) {
+	var tokens, durations []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		if form.Get("Action") != "AssumeRoleWithWebIdentity" || r.Header.Get("Authorization") != "" {
+			t.Errorf("Expected unsigned AssumeRoleWithWebIdentity, actual %v", form.Get("Action"))
+		}
+		tokens = append(tokens, form.Get("WebIdentityToken"))
+		durations = append(durations, form.Get("DurationSeconds"))
+		fmt.Fprintf(w, assumeRoleWithWebIdentityResponse, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "TestWebIdentityCredentials-")
+	if err != nil {
+		t.Fatalf("Temp directory creation failed, err=%v", err)
+	}
+	defer os.RemoveAll(dir)
+	tokenFile := filepath.Join(dir, "token")
+	if err := ioutil.WriteFile(tokenFile, []byte("first"), 0600); err != nil {
+		t.Fatalf("Failed to write token, err=%v", err)
+	}
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:   aws.String("us-east-1"),
+		Endpoint: aws.String(server.URL),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session, err=%v", err)
+	}
+	chain := roleChain{{
+		arn:         "arn:aws:iam::123456789012:role/ci",
+		duration:    2 * time.Hour,
+		webIdentity: &webIdentityToken{stscreds.FetchTokenPath(tokenFile), "file:" + tokenFile},
+	}}
+	creds, err := chain.credentials(sess, nil, "")
+	if err != nil {
+		t.Fatalf("Failed to create credentials, err=%v", err)
+	}
+	v, err := creds.Get()
+	if err != nil {
+		t.Fatalf("Failed to assume role, err=%v", err)
+	}
+	if v.AccessKeyID != "ASIAWEB" {
+		t.Errorf("Expected web identity credentials, actual %v", v.AccessKeyID)
+	}
+
+	// the kubelet and CI systems replace the token before it expires
+	if err := ioutil.WriteFile(tokenFile, []byte("second"), 0600); err != nil {
+		t.Fatalf("Failed to write token, err=%v", err)
+	}
+	creds.Expire()
+	if _, err := creds.Get(); err != nil {
+		t.Fatalf("Failed to assume role, err=%v", err)
+	}
+	if len(tokens) != 2 || tokens[0] != "first" || tokens[1] != "second" {
+		t.Errorf("Expected tokens [first second], actual %v", tokens)
+	}
+	if len(durations) != 2 || durations[0] != "7200" {
+		t.Errorf("Expected durations of 7200 seconds, actual %v", durations)
+	}
+}
+
+// TestCheckWebIdentityRole tests that options AssumeRoleWithWebIdentity does not accept are rejected.
+func TestCheckWebIdentityRole(t *testing.T) {
+	token := &webIdentityToken{fetchTokenEnv("TEST_WEB_IDENTITY_TOKEN"), "env:TEST_WEB_IDENTITY_TOKEN"}
+	for _, r := range []*assumeRole{
+		{arn: "arn:aws:iam::123456789012:role/ci", webIdentity: token, externalID: "id"},
+		{arn: "arn:aws:iam::123456789012:role/ci", webIdentity: token, tags: []*sts.Tag{{Key: aws.String("k"), Value: aws.String("v")}}},
+		{arn: "arn:aws:iam::123456789012:role/ci", webIdentity: token, sourceIdentity: "me"},
+	} {
+		if err := checkWebIdentityRole(r); err == nil {
+			t.Errorf("Expected error for %+v", r)
+		}
+	}
+	for _, r := range []*assumeRole{
+		{arn: "arn:aws:iam::123456789012:role/ci", webIdentity: token, duration: time.Hour, sessionName: "ci"},
+		{arn: "arn:aws:iam::123456789012:role/ci", externalID: "id"},
+	} {
+		if err := checkWebIdentityRole(r); err != nil {
+			t.Errorf("Unexpected error %v for %+v", err, r)
+		}
+	}
+}
+
+// TestFetchTokenEnv tests that the web identity token is read from the environment and trimmed.
+func TestFetchTokenEnv(t *testing.T) {
+	os.Setenv("TEST_WEB_IDENTITY_TOKEN", " token\n")
+	defer os.Unsetenv("TEST_WEB_IDENTITY_TOKEN")
+
+	token := &webIdentityToken{fetchTokenEnv("TEST_WEB_IDENTITY_TOKEN"), "env:TEST_WEB_IDENTITY_TOKEN"}
+	if b, err := token.FetchToken(aws.BackgroundContext()); err != nil || string(b) != "token" {
+		t.Errorf("Expected token %q, actual %q, err=%v", "token", b, err)
+	}
+	os.Unsetenv("TEST_WEB_IDENTITY_TOKEN")
+	if _, err := token.FetchToken(aws.BackgroundContext()); err == nil {
+		t.Errorf("Expected error for unset token environment variable")
+	}
+}
@@ -10,4 +10,6 @@ require (
 	github.com/sirupsen/logrus v1.4.2
 	github.com/spf13/cobra v0.0.5
 	github.com/spf13/pflag v1.0.5
+	golang.org/x/sys v0.0.0-20200302150141-5c8b2ff67527
+	gopkg.in/yaml.v2 v2.2.8
 )
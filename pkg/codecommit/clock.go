@@ -0,0 +1,83 @@
+package codecommit
+
+import (
+	"fmt"
+	"net/http"
+	nurl "net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+//MaxClockSkew is the difference between local and server time above which
+//CodeCommit rejects signatures, and a warning is logged.
+const MaxClockSkew = 5 * time.Minute
+
+//WithClock sets the local clock, which passwords are signed with, eg. for testing.
+func WithClock(now func() time.Time) func(*CloneURL) {
+	return func(c *CloneURL) {
+		c.Now = now
+	}
+}
+
+//WithSkewCorrection signs with the server's time, measured from the Date
+//header of a request to the CodeCommit endpoint using client, see CheckClockSkew.
+func WithSkewCorrection(client *http.Client) func(*CloneURL) {
+	return func(c *CloneURL) {
+		c.skewClient = client
+	}
+}
+
+//correctSkew measures the offset from the server's time, which is added to
+//the local time passwords are signed with
+func (c *CloneURL) correctSkew() error {
+	offset, err := CheckClockSkew(c.skewClient, c.u.Host)
+	if err != nil {
+		return err
+	}
+	c.skew = offset
+	return nil
+}
+
+//CheckClockSkew return how far the time of the CodeCommit server host is
+//ahead of local time, using client. A warning is logged if it differs by
+//more than MaxClockSkew, eg. when checking why a password was rejected.
+func CheckClockSkew(client *http.Client, host string) (time.Duration, error) {
+	endpoint := nurl.URL{Scheme: "https", Host: host, Path: "/"}
+	offset, err := ServerTimeOffset(client, endpoint.String())
+	if err != nil {
+		return 0, err
+	}
+	if offset > MaxClockSkew || offset < -MaxClockSkew {
+		log.Warnf("local time differs from %s by %v, CodeCommit will reject signatures unless the clock is corrected",
+			host, offset.Round(time.Second))
+	}
+	return offset, nil
+}
+
+//ServerTimeOffset return how far the time of the server at url is ahead of
+//local time, from the Date header of a HEAD request. Its precision is limited
+//to a second by the header.
+func ServerTimeOffset(client *http.Client, url string) (time.Duration, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	start := time.Now()
+	resp, err := client.Head(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	// assume the server's time was taken halfway through the request
+	local := start.Add(time.Since(start) / 2)
+
+	date := resp.Header.Get("Date")
+	if date == "" {
+		return 0, fmt.Errorf("no Date header in response from %s", url)
+	}
+	server, err := http.ParseTime(date)
+	if err != nil {
+		return 0, fmt.Errorf("invalid Date header %q in response from %s: %v", date, url, err)
+	}
+	return server.Sub(local).Truncate(time.Second), nil
+}
@@ -0,0 +1,124 @@
+package codecommit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	log "github.com/sirupsen/logrus"
+)
+
+// dateTransport is a http.RoundTripper responding with the Date header for the time offset from now
+type dateTransport struct {
+	offset time.Duration
+}
+
+func (d *dateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header := http.Header{}
+	header.Set("Date", time.Now().Add(d.offset).UTC().Format(http.TimeFormat))
+	return &http.Response{
+		StatusCode: http.StatusForbidden,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func newStaticSession(t *testing.T, region string) *session.Session {
+	t.Helper()
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String(region),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create session, err=%v", err)
+	}
+	return sess
+}
+
+// TestCloneURLWithClock tests that the pre-computed signature is generated with an injected clock.
+func TestCloneURLWithClock(t *testing.T) {
+	tf := "20060102T150405"
+	signTime, err := time.Parse(tf, tf)
+	if err != nil {
+		t.Fatalf("Failed to parse time %v (err: %v)", tf, err)
+	}
+
+	sess := newStaticSession(t, "ca-central-1")
+	c, err := NewCloneURL(sess, "https://git-codecommit.ca-central-1.amazonaws.com/v1/repos/test-lcc2",
+		WithClock(func() time.Time { return signTime }))
+	if err != nil {
+		t.Fatalf("Failed to create CloneURL, err=%v", err)
+	}
+	creds, err := c.GetCodeCommitCredentials()
+	if err != nil {
+		t.Fatalf("Failed to get credentials, err=%v", err)
+	}
+	if creds.Password != expectedSignature {
+		t.Fatalf("Expected signature %v, actual %v", expectedSignature, creds.Password)
+	}
+}
+
+// TestServerTimeOffset tests the offset is measured from the Date header.
+func TestServerTimeOffset(t *testing.T) {
+	client := &http.Client{Transport: &dateTransport{offset: -10 * time.Minute}}
+	offset, err := ServerTimeOffset(client, "https://git-codecommit.us-east-1.amazonaws.com/")
+	if err != nil {
+		t.Fatalf("Failed to measure offset, err=%v", err)
+	}
+	if offset > -9*time.Minute || offset < -11*time.Minute {
+		t.Fatalf("Expected offset of about -10m, actual %v", offset)
+	}
+}
+
+// TestCheckClockSkew tests that a warning is logged for a skew above MaxClockSkew.
+func TestCheckClockSkew(t *testing.T) {
+	var out bytes.Buffer
+	log.SetOutput(&out)
+	defer log.SetOutput(os.Stderr)
+
+	for offset, warned := range map[time.Duration]bool{time.Minute: false, -10 * time.Minute: true} {
+		out.Reset()
+		client := &http.Client{Transport: &dateTransport{offset: offset}}
+		if _, err := CheckClockSkew(client, "git-codecommit.us-east-1.amazonaws.com"); err != nil {
+			t.Fatalf("Failed to check skew, err=%v", err)
+		}
+		if actual := strings.Contains(out.String(), "local time differs"); actual != warned {
+			t.Errorf("Expected warning %v for offset %v, actual %q", warned, offset, out.String())
+		}
+	}
+}
+
+// TestCloneURLWithSkewCorrection tests that the signing time is adjusted to the server's time, and the expiry is in local time.
+func TestCloneURLWithSkewCorrection(t *testing.T) {
+	signTime := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	client := &http.Client{Transport: &dateTransport{offset: time.Hour}}
+
+	sess := newStaticSession(t, "us-east-1")
+	c, err := NewCloneURL(sess, "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/repo",
+		WithClock(func() time.Time { return signTime }), WithSkewCorrection(client))
+	if err != nil {
+		t.Fatalf("Failed to create CloneURL, err=%v", err)
+	}
+	ctx, err := c.SigningContext()
+	if err != nil {
+		t.Fatalf("Failed to get signing context, err=%v", err)
+	}
+	if ctx.Time.Before(signTime.Add(59*time.Minute)) || ctx.Time.After(signTime.Add(61*time.Minute)) {
+		t.Fatalf("Expected signing time of about %v, actual %v", signTime.Add(time.Hour), ctx.Time)
+	}
+	creds, err := c.GetCodeCommitCredentials()
+	if err != nil {
+		t.Fatalf("Failed to get credentials, err=%v", err)
+	}
+	if expected := signTime.Add(SignatureLifetime); !creds.Expiry.Equal(expected) {
+		t.Fatalf("Expected expiry %v in local time, actual %v", expected, creds.Expiry)
+	}
+}
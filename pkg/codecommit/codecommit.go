@@ -2,9 +2,9 @@ package codecommit
 
 import (
 	"fmt"
+	"net/http"
 	nurl "net/url"
 	"regexp"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -12,9 +12,18 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 )
 
+//RegionRe matches public CodeCommit Git hostnames, sub-match 1 is the region.
 //
+//Deprecated: use ParseEndpoint, which also parses FIPS and VPC endpoint hostnames.
 var RegionRe *regexp.Regexp
 
+const (
+	//SignatureLifetime is how long CodeCommit accepts a password after it was signed
+	SignatureLifetime = 15 * time.Minute
+	//CredentialRefreshWindow credentials expiring within this window are refreshed before signing
+	CredentialRefreshWindow = 5 * time.Minute
+)
+
 func init() {
 	RegionRe = regexp.MustCompile(`git-codecommit\.([^.]+)\.amazonaws\.com`)
 }
@@ -25,31 +34,53 @@ func IsCodeCommitURL(url string) bool {
 	if err != nil {
 		return false
 	}
-	return RegionRe.MatchString(u.Host)
+	_, err = ParseEndpoint(u.Host)
+	return err == nil
 }
 
-//NewCloneURL return CloneURL object for CodeCommit
-func NewCloneURL(sess *session.Session, url string) (*CloneURL, error) {
+//NewCloneURL return CloneURL object for CodeCommit, options are applied in order
+//eg. WithClock, WithSkewCorrection
+func NewCloneURL(sess *session.Session, url string, options ...func(*CloneURL)) (*CloneURL, error) {
 	c := &CloneURL{
 		RawURL: url,
+		Now:    time.Now,
 	}
 	if err := c.setURL(); err != nil {
 		return nil, err
 	}
+	for _, option := range options {
+		option(c)
+	}
+	if c.skewClient != nil {
+		if err := c.correctSkew(); err != nil {
+			return nil, fmt.Errorf("unable to correct clock skew: %v", err)
+		}
+	}
 
-	creds, err := sess.Config.Credentials.Get()
-	if err != nil {
+	// retrieve credentials up front so that errors are reported by NewCloneURL
+	c.Credentials = sess.Config.Credentials
+	if _, err := c.Credentials.Get(); err != nil {
 		return nil, err
 	}
 
-	c.CredValues = creds
+	if err := c.checkSessionPartition(sess); err != nil {
+		return nil, err
+	}
 	return c, nil
 }
 
 type CloneURL struct {
-	RawURL     string
-	CredValues credentials.Value
+	RawURL string
+	//Credentials are retrieved each time a password is signed, see retrieveCredentials
+	Credentials *credentials.Credentials
+	//Now returns the local time, passwords are signed with it corrected for
+	//the server's time, see WithClock and WithSkewCorrection
+	Now func() time.Time
+
 	u          *nurl.URL
+	skewClient *http.Client
+	//skew is how far the server's time is ahead of local time, when corrected
+	skew time.Duration
 }
 
 func (c *CloneURL) setURL() error {
@@ -67,7 +98,7 @@ func (c *CloneURL) buildCloneURL() error {
 	if err != nil {
 		return err
 	}
-	if c.u.User == nil && strings.Split(c.u.Hostname(), ".")[0] == "git-codecommit" {
+	if c.u.User == nil && IsCodeCommitURL(c.RawURL) {
 		if err = c.addCodeCommitCreds(); err != nil {
 			return err
 		}
@@ -86,32 +117,137 @@ func (c *CloneURL) addCodeCommitCreds() error {
 }
 
 func (c *CloneURL) String() string {
-	err := c.buildCloneURL()
+	signed, err := c.SignedURL()
 	if err != nil {
 		return ""
 	}
-	return c.u.String()
+	return signed
+}
+
+//SignedURL return the URL with CodeCommit credentials included
+func (c *CloneURL) SignedURL() (string, error) {
+	if err := c.buildCloneURL(); err != nil {
+		return "", err
+	}
+	return c.u.String(), nil
 }
 
-//GetCodeCommitCredentials return CodeCommitCredentials for URL
+//GetCodeCommitCredentials return CodeCommitCredentials for URL, signed with
+//the current credentials. Their expiry is in local time, as git compares it
+//with the local clock.
 func (c *CloneURL) GetCodeCommitCredentials() (*CodeCommitCredentials, error) {
-	region, err := c.parseRegion()
+	ctx, credExpiry, err := c.signingContext()
 	if err != nil {
 		return nil, err
 	}
-
-	ctx := NewSigningContext(c.u, region, endpoints.CodecommitServiceID, c.CredValues, time.Now())
-	username := c.CredValues.AccessKeyID
-	if c.CredValues.SessionToken != "" {
-		username = fmt.Sprintf("%s%%%s", username, c.CredValues.SessionToken)
+	if !credExpiry.IsZero() {
+		credExpiry = credExpiry.Add(-c.skew)
 	}
 
 	return &CodeCommitCredentials{
-		Username: username,
+		Username: codeCommitUsername(ctx.CredValues),
 		Password: ctx.signCodeCommitRequest(),
+		Expiry:   expiry(ctx.Time.Add(-c.skew), credExpiry),
 	}, nil
 }
 
+//SigningContext return the SigningCtx for a password for URL signed now
+func (c *CloneURL) SigningContext() (*SigningCtx, error) {
+	ctx, _, err := c.signingContext()
+	return ctx, err
+}
+
+//signingContext return the SigningCtx for a password for URL signed now, in
+//the server's time, and when the credentials it is signed with expire.
+func (c *CloneURL) signingContext() (*SigningCtx, time.Time, error) {
+	region, err := c.parseRegion()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	signTime := c.now().Add(c.skew)
+	creds, credExpiry, err := c.retrieveCredentials(signTime)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	ctx := NewSigningContext(c.u, region, endpoints.CodecommitServiceID, creds, signTime)
+	return &ctx, credExpiry, nil
+}
+
+//now return the local time of the clock set with WithClock
+func (c *CloneURL) now() time.Time {
+	if c.Now == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+//retrieveCredentials return the current credentials and when they expire, zero
+//if they do not. Credentials expiring within CredentialRefreshWindow of now are
+//refreshed first, so that passwords are not signed with keys about to expire.
+func (c *CloneURL) retrieveCredentials(now time.Time) (credentials.Value, time.Time, error) {
+	if c.Credentials == nil {
+		return credentials.Value{}, time.Time{}, fmt.Errorf("credentials are not set")
+	}
+	creds, err := c.Credentials.Get()
+	if err != nil {
+		return creds, time.Time{}, err
+	}
+	// credentials from providers which do not expire return an error
+	credExpiry, err := c.Credentials.ExpiresAt()
+	if err != nil {
+		return creds, time.Time{}, nil
+	}
+	if credExpiry.Sub(now) < CredentialRefreshWindow {
+		c.Credentials.Expire()
+		if creds, err = c.Credentials.Get(); err != nil {
+			return creds, time.Time{}, err
+		}
+		if credExpiry, err = c.Credentials.ExpiresAt(); err != nil {
+			return creds, time.Time{}, err
+		}
+	}
+	return creds, credExpiry, nil
+}
+
+//codeCommitUsername return the username for credentials, the access key ID
+//followed by %<session token> for temporary credentials.
+func codeCommitUsername(v credentials.Value) string {
+	if v.SessionToken == "" {
+		return v.AccessKeyID
+	}
+	return fmt.Sprintf("%s%%%s", v.AccessKeyID, v.SessionToken)
+}
+
+//expiry return when a password signed at signTime, with credentials expiring
+//at credExpiry (zero if they do not), stops being accepted
+func expiry(signTime, credExpiry time.Time) time.Time {
+	expiry := signTime.Add(SignatureLifetime)
+	if !credExpiry.IsZero() && credExpiry.Before(expiry) {
+		return credExpiry
+	}
+	return expiry
+}
+
+//checkSessionPartition return an error if the session is configured for a
+//region in a different partition than the repository.
+func (c *CloneURL) checkSessionPartition(sess *session.Session) error {
+	if sess.Config.Region == nil || *sess.Config.Region == "" {
+		return nil
+	}
+	e, err := ParseEndpoint(c.u.Host)
+	if err != nil {
+		// not a CodeCommit URL, there is nothing to sign
+		return nil
+	}
+	p, ok := endpoints.PartitionForRegion(endpoints.DefaultPartitions(), *sess.Config.Region)
+	if ok && p.ID() != e.Partition {
+		return fmt.Errorf("AWS session region %q is in partition %q, but CodeCommit repository %q is in partition %q",
+			*sess.Config.Region, p.ID(), c.u.Host, e.Partition)
+	}
+	return nil
+}
+
 func (c *CloneURL) parseRegion() (string, error) {
 	if c.u == nil {
 		return "", fmt.Errorf("url is not set")
@@ -120,16 +256,18 @@ func (c *CloneURL) parseRegion() (string, error) {
 	return ParseRegion(c.u.Host)
 }
 
+//ParseRegion return the region of the CodeCommit endpoint host, which may include a port or be a URL.
 func ParseRegion(host string) (string, error) {
-	match := RegionRe.FindStringSubmatch(host)
-	if match != nil {
-		return match[1], nil
+	e, err := ParseEndpoint(host)
+	if err != nil {
+		return "", err
 	}
-
-	return "", fmt.Errorf("invalid CodeCommit URL %q", host)
+	return e.Region, nil
 }
 
 type CodeCommitCredentials struct {
 	Username string
 	Password string
+	//Expiry is when the password stops being accepted
+	Expiry time.Time
 }
@@ -1,7 +1,12 @@
 package codecommit
 
 import (
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
 )
 
 func TestCloneURLRegion(t *testing.T) {
@@ -23,6 +28,125 @@ func TestCloneURLInvalidRegion(t *testing.T) {
 	e.assertInvalidRegion()
 }
 
+// TestCloneURLExpiry tests that the password expiry is limited by the expiry of the credentials.
+func TestCloneURLExpiry(t *testing.T) {
+	signTime := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	if actual, expected := expiry(signTime, time.Time{}), signTime.Add(SignatureLifetime); !actual.Equal(expected) {
+		t.Errorf("expected expiry %v, actual %v", expected, actual)
+	}
+
+	credExpiry := signTime.Add(time.Minute)
+	if actual, expected := expiry(signTime, credExpiry), credExpiry; !actual.Equal(expected) {
+		t.Errorf("expected expiry %v, actual %v", expected, actual)
+	}
+}
+
+// rotatingProvider is an expiring credentials.Provider which returns a new access key ID on each Retrieve()
+type rotatingProvider struct {
+	credentials.Expiry
+	calls    int
+	lifetime time.Duration
+}
+
+func (p *rotatingProvider) Retrieve() (credentials.Value, error) {
+	p.calls++
+	p.SetExpiration(time.Now().Add(p.lifetime), 0)
+	return credentials.Value{
+		AccessKeyID:     fmt.Sprintf("AKID%d", p.calls),
+		SecretAccessKey: "SECRET",
+		SessionToken:    "TOKEN",
+	}, nil
+}
+
+// TestCloneURLRefresh tests that each password is signed with current credentials, refreshed when close to expiry.
+func TestCloneURLRefresh(t *testing.T) {
+	provider := &rotatingProvider{lifetime: time.Hour}
+	sess := newStaticSession(t, "us-east-1")
+	sess.Config.Credentials = credentials.NewCredentials(provider)
+
+	c, err := NewCloneURL(sess, "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/repo")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	username := func() string {
+		t.Helper()
+		creds, err := c.GetCodeCommitCredentials()
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return creds.Username
+	}
+
+	if actual := username(); actual != "AKID1%TOKEN" {
+		t.Errorf("expected username %q, actual %q", "AKID1%TOKEN", actual)
+	}
+	c.Credentials.Expire()
+	if actual := username(); actual != "AKID2%TOKEN" {
+		t.Errorf("expected credentials to be re-fetched, actual username %q", actual)
+	}
+	if !strings.Contains(c.String(), "AKID2%25TOKEN") {
+		t.Errorf("expected URL signed with current credentials, actual %q", c.String())
+	}
+
+	provider.lifetime = CredentialRefreshWindow / 2
+	c.Credentials.Expire()
+	username()
+	if actual := username(); actual != fmt.Sprintf("AKID%d%%TOKEN", provider.calls) || provider.calls != 5 {
+		t.Errorf("expected credentials close to expiry to be refreshed, calls %d, actual username %q", provider.calls, actual)
+	}
+}
+
+// expiringProvider is a credentials.Provider whose credentials expire at a set time
+type expiringProvider struct {
+	credentials.Expiry
+	calls      int
+	expiration time.Time
+}
+
+func (p *expiringProvider) Retrieve() (credentials.Value, error) {
+	p.calls++
+	p.SetExpiration(p.expiration, 0)
+	return credentials.Value{AccessKeyID: "AKID", SecretAccessKey: "SECRET", SessionToken: "TOKEN"}, nil
+}
+
+// TestCloneURLRefreshWindow tests that credentials are refreshed when they expire within the window of the injected clock.
+func TestCloneURLRefreshWindow(t *testing.T) {
+	now := time.Now()
+	provider := &expiringProvider{expiration: now.Add(time.Hour)}
+	sess := newStaticSession(t, "us-east-1")
+	sess.Config.Credentials = credentials.NewCredentials(provider)
+
+	c, err := NewCloneURL(sess, "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/repo",
+		WithClock(func() time.Time { return now }))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := c.GetCodeCommitCredentials(); err != nil || provider.calls != 1 {
+		t.Fatalf("expected credentials not to be refreshed, calls %d, err=%v", provider.calls, err)
+	}
+
+	now = now.Add(time.Hour - CredentialRefreshWindow/2)
+	creds, err := c.GetCodeCommitCredentials()
+	if err != nil || provider.calls != 2 {
+		t.Fatalf("expected credentials within the refresh window to be refreshed, calls %d, err=%v", provider.calls, err)
+	}
+	if !creds.Expiry.Equal(provider.expiration) {
+		t.Errorf("expected expiry of the credentials %v, actual %v", provider.expiration, creds.Expiry)
+	}
+}
+
+// TestNewCloneURLPartition tests that a session for a region in another partition is rejected.
+func TestNewCloneURLPartition(t *testing.T) {
+	sess := newStaticSession(t, "us-east-1")
+	if _, err := NewCloneURL(sess, "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/repo"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, err := NewCloneURL(sess, "https://git-codecommit.cn-north-1.amazonaws.com.cn/v1/repos/repo"); err == nil {
+		t.Errorf("expected error not returned")
+	}
+}
+
 func NewCloneURLTest(t *testing.T, topts TestOptions) *CloneURLTest {
 	return &CloneURLTest{
 		t,
@@ -0,0 +1,135 @@
+package codecommit
+
+import (
+	"fmt"
+	nurl "net/url"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+//Endpoint is a parsed CodeCommit Git endpoint hostname, one of:
+//	git-codecommit.<region>.<dns-suffix>
+//	git-codecommit-fips.<region>.<dns-suffix>
+//	<vpce-id>.git-codecommit.<region>.vpce.<dns-suffix>
+//where dns-suffix is that of the region's partition, eg. amazonaws.com or amazonaws.com.cn
+type Endpoint struct {
+	//Host is the lower case hostname, without a port
+	Host   string
+	Region string
+	//Partition is the AWS partition ID of Region, eg. "aws", "aws-cn" or "aws-us-gov"
+	Partition string
+	FIPS      bool
+	//VPCEndpoint is the VPC endpoint DNS prefix eg. "vpce-0abc-xyz", empty for public endpoints
+	VPCEndpoint string
+}
+
+//endpointRe matches CodeCommit Git endpoint hostnames, see Endpoint
+var endpointRe = regexp.MustCompile(`^(?:(vpce-[a-z0-9-]+)\.)?git-codecommit(-fips)?\.([a-z0-9-]+)\.(vpce\.)?([a-z0-9.-]+)$`)
+
+//regionNameRe matches AWS region names, eg. us-east-1 or us-gov-west-1
+var regionNameRe = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-[0-9]+$`)
+
+// endpointRe sub-matches
+const (
+	regionReVPCEndpoint = iota + 1
+	regionReFIPS
+	regionReRegion
+	regionReVPCEDomain
+	regionReDNSSuffix
+)
+
+//NewEndpoint return the public CodeCommit endpoint for region, or the FIPS endpoint if fips is set.
+func NewEndpoint(region string, fips bool) (*Endpoint, error) {
+	p, err := partitionForRegion(region)
+	if err != nil {
+		return nil, err
+	}
+	service := "git-codecommit"
+	if fips {
+		service += "-fips"
+	}
+	return &Endpoint{
+		Host:      strings.Join([]string{service, region, p.DNSSuffix()}, "."),
+		Region:    region,
+		Partition: p.ID(),
+		FIPS:      fips,
+	}, nil
+}
+
+//knownPartition return the partition of region from the SDK's endpoints data
+func knownPartition(region string) (endpoints.Partition, bool) {
+	return endpoints.PartitionForRegion(endpoints.DefaultPartitions(), region)
+}
+
+//partitionForRegion return the partition of region, regions newer than the
+//SDK's endpoints data are assumed to be in the aws partition.
+func partitionForRegion(region string) (endpoints.Partition, error) {
+	if p, ok := knownPartition(region); ok {
+		return p, nil
+	}
+	if !regionNameRe.MatchString(region) {
+		return endpoints.Partition{}, fmt.Errorf("unknown AWS region %q", region)
+	}
+	return endpoints.AwsPartition(), nil
+}
+
+//ParseEndpoint return the Endpoint for host, which may include a port or be a URL.
+func ParseEndpoint(host string) (*Endpoint, error) {
+	hostname := endpointHostname(host)
+	match := endpointRe.FindStringSubmatch(hostname)
+	if match == nil {
+		return nil, fmt.Errorf("invalid CodeCommit URL %q", host)
+	}
+
+	e := &Endpoint{
+		Host:        hostname,
+		Region:      match[regionReRegion],
+		FIPS:        match[regionReFIPS] != "",
+		VPCEndpoint: match[regionReVPCEndpoint],
+	}
+	// VPC endpoint names are only valid within the vpce domain, and vice versa
+	if (e.VPCEndpoint != "") != (match[regionReVPCEDomain] != "") {
+		return nil, fmt.Errorf("invalid CodeCommit VPC endpoint %q", host)
+	}
+
+	suffix := match[regionReDNSSuffix]
+	p, known := knownPartition(e.Region)
+	switch {
+	case !known && suffix == endpoints.AwsPartition().DNSSuffix() && regionNameRe.MatchString(e.Region):
+		// a region newer than the SDK's endpoints data
+		p = endpoints.AwsPartition()
+	case !known:
+		return nil, fmt.Errorf("invalid CodeCommit URL %q: unknown AWS region %q", host, e.Region)
+	case suffix != p.DNSSuffix():
+		return nil, fmt.Errorf("invalid CodeCommit URL %q: region %q is in partition %q which uses %q, not %q",
+			host, e.Region, p.ID(), p.DNSSuffix(), suffix)
+	}
+	e.Partition = p.ID()
+	return e, nil
+}
+
+//endpointHostname return the lower case hostname without a port from a host or URL
+func endpointHostname(host string) string {
+	if strings.Contains(host, "://") {
+		if u, err := nurl.Parse(host); err == nil {
+			return strings.ToLower(u.Hostname())
+		}
+	}
+	u := nurl.URL{Host: host}
+	return strings.ToLower(u.Hostname())
+}
+
+//CheckARN return an error if arn, eg. of a role to assume, is not in the endpoint's partition.
+func (e *Endpoint) CheckARN(arn string) error {
+	parts := strings.SplitN(arn, ":", 3)
+	if len(parts) < 3 || parts[0] != "arn" {
+		return fmt.Errorf("invalid ARN %q", arn)
+	}
+	if parts[1] != e.Partition {
+		return fmt.Errorf("ARN %q is in partition %q, but CodeCommit endpoint %q is in partition %q",
+			arn, parts[1], e.Host, e.Partition)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package codecommit
+
+import (
+	"testing"
+)
+
+// TestParseEndpoint tests parsing of public, FIPS and VPC endpoint hostnames.
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		host     string
+		expected Endpoint
+	}{
+		{
+			"git-codecommit.ca-central-1.amazonaws.com",
+			Endpoint{Host: "git-codecommit.ca-central-1.amazonaws.com", Region: "ca-central-1", Partition: "aws"},
+		},
+		{
+			"https://git-codecommit.ca-central-1.amazonaws.com:443/v1/repos/repo",
+			Endpoint{Host: "git-codecommit.ca-central-1.amazonaws.com", Region: "ca-central-1", Partition: "aws"},
+		},
+		{
+			"git-codecommit-fips.us-east-1.amazonaws.com",
+			Endpoint{Host: "git-codecommit-fips.us-east-1.amazonaws.com", Region: "us-east-1", Partition: "aws", FIPS: true},
+		},
+		{
+			"vpce-0abc-xyz.git-codecommit.us-east-1.vpce.amazonaws.com",
+			Endpoint{
+				Host:        "vpce-0abc-xyz.git-codecommit.us-east-1.vpce.amazonaws.com",
+				Region:      "us-east-1",
+				Partition:   "aws",
+				VPCEndpoint: "vpce-0abc-xyz",
+			},
+		},
+		{
+			"git-codecommit.cn-north-1.amazonaws.com.cn",
+			Endpoint{Host: "git-codecommit.cn-north-1.amazonaws.com.cn", Region: "cn-north-1", Partition: "aws-cn"},
+		},
+		{
+			"git-codecommit.us-gov-west-1.amazonaws.com",
+			Endpoint{Host: "git-codecommit.us-gov-west-1.amazonaws.com", Region: "us-gov-west-1", Partition: "aws-us-gov"},
+		},
+	}
+	for _, test := range tests {
+		actual, err := ParseEndpoint(test.host)
+		if err != nil {
+			t.Errorf("Failed to parse %q, err=%v", test.host, err)
+			continue
+		}
+		if *actual != test.expected {
+			t.Errorf("expected endpoint %v, actual %v", test.expected, *actual)
+		}
+	}
+}
+
+// TestParseEndpointInvalid tests that hosts which are not CodeCommit endpoints are rejected.
+func TestParseEndpointInvalid(t *testing.T) {
+	for _, host := range []string{
+		"",
+		"github.com",
+		"git-codecommit.us-east-1.amazonaws.com.example.com",
+		"vpce-0abc-xyz.git-codecommit.us-east-1.amazonaws.com",
+		"git-codecommit.us-east-1.vpce.amazonaws.com",
+		"git-codecommit.cn-north-1.amazonaws.com",
+		"git-codecommit.us-east-1.amazonaws.com.cn",
+		"git-codecommit.nowhere.amazonaws.com",
+	} {
+		if e, err := ParseEndpoint(host); err == nil {
+			t.Errorf("expected error not returned for %q, actual %v", host, e)
+		}
+	}
+}
+
+// TestParseEndpointUnknownRegion tests that regions newer than the SDK's endpoints data are in the aws partition.
+func TestParseEndpointUnknownRegion(t *testing.T) {
+	for _, host := range []string{
+		"git-codecommit.il-central-1.amazonaws.com",
+		"git-codecommit-fips.mx-central-1.amazonaws.com",
+		"vpce-0abc-xyz.git-codecommit.mx-central-1.vpce.amazonaws.com",
+	} {
+		e, err := ParseEndpoint(host)
+		if err != nil {
+			t.Errorf("Failed to parse %q, err=%v", host, err)
+			continue
+		}
+		if e.Partition != "aws" {
+			t.Errorf("expected partition aws for %q, actual %q", host, e.Partition)
+		}
+	}
+
+	if e, err := ParseEndpoint("git-codecommit.il-central-1.amazonaws.com.cn"); err == nil {
+		t.Errorf("expected error not returned for an unknown region outside the aws partition, actual %v", e)
+	}
+	if e, err := NewEndpoint("mx-central-1", false); err != nil || e.Host != "git-codecommit.mx-central-1.amazonaws.com" {
+		t.Errorf("unexpected endpoint %v, err=%v", e, err)
+	}
+}
+
+// TestNewEndpoint tests that endpoints use the DNS suffix of the region's partition.
+func TestNewEndpoint(t *testing.T) {
+	tests := []struct {
+		region   string
+		fips     bool
+		expected string
+	}{
+		{"us-east-1", false, "git-codecommit.us-east-1.amazonaws.com"},
+		{"us-gov-west-1", true, "git-codecommit-fips.us-gov-west-1.amazonaws.com"},
+		{"cn-northwest-1", false, "git-codecommit.cn-northwest-1.amazonaws.com.cn"},
+	}
+	for _, test := range tests {
+		e, err := NewEndpoint(test.region, test.fips)
+		if err != nil {
+			t.Errorf("Failed to create endpoint for %q, err=%v", test.region, err)
+			continue
+		}
+		if e.Host != test.expected {
+			t.Errorf("expected host %q, actual %q", test.expected, e.Host)
+		}
+	}
+}
+
+// TestEndpointCheckARN tests that ARNs from another partition are rejected.
+func TestEndpointCheckARN(t *testing.T) {
+	e, err := ParseEndpoint("git-codecommit.cn-north-1.amazonaws.com.cn")
+	if err != nil {
+		t.Fatalf("Failed to parse endpoint, err=%v", err)
+	}
+	if err := e.CheckARN("arn:aws-cn:iam::123456789012:role/test"); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := e.CheckARN("arn:aws:iam::123456789012:role/test"); err == nil {
+		t.Errorf("expected error not returned")
+	}
+}
+
+// TestRegionRe tests that the deprecated RegionRe still sub-matches the region of hosts with a port.
+func TestRegionRe(t *testing.T) {
+	match := RegionRe.FindStringSubmatch("git-codecommit.us-east-1.amazonaws.com:443")
+	if len(match) != 2 || match[1] != "us-east-1" {
+		t.Errorf("expected region %q, actual %q", "us-east-1", match)
+	}
+}
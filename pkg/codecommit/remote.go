@@ -0,0 +1,69 @@
+package codecommit
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	//RemoteScheme is the scheme of git-remote-codecommit URLs
+	RemoteScheme = "codecommit"
+)
+
+var repositoryNameRe = regexp.MustCompile(`^[\w.-]{1,100}$`)
+
+//RemoteURL is a parsed git-remote-codecommit URL, one of:
+//	codecommit://[profile@]repository
+//	codecommit::<region>://[profile@]repository
+//git passes the latter to the remote helper without the "codecommit::" prefix.
+type RemoteURL struct {
+	//Region is empty when it should be taken from the AWS config
+	Region string
+	//Profile is empty for the default credentials
+	Profile string
+	//Name of the repository
+	Name string
+}
+
+//ParseRemoteURL return the RemoteURL for url
+func ParseRemoteURL(url string) (*RemoteURL, error) {
+	address := strings.TrimPrefix(url, RemoteScheme+"::")
+	i := strings.Index(address, "://")
+	if i < 1 {
+		return nil, fmt.Errorf("invalid CodeCommit remote URL %q", url)
+	}
+	scheme, netloc := address[:i], address[i+len("://"):]
+
+	r := &RemoteURL{}
+	if scheme != RemoteScheme {
+		if _, err := partitionForRegion(scheme); err != nil {
+			return nil, fmt.Errorf("invalid CodeCommit remote URL %q: %v", url, err)
+		}
+		r.Region = scheme
+	}
+	if i := strings.LastIndex(netloc, "@"); i >= 0 {
+		r.Profile, netloc = netloc[:i], netloc[i+1:]
+		if r.Profile == "" {
+			return nil, fmt.Errorf("invalid CodeCommit remote URL %q: empty profile", url)
+		}
+	}
+	if !repositoryNameRe.MatchString(netloc) {
+		return nil, fmt.Errorf("invalid CodeCommit remote URL %q: invalid repository name %q", url, netloc)
+	}
+	r.Name = netloc
+	return r, nil
+}
+
+//Repository return the repository, using region if the URL has none.
+func (r *RemoteURL) Repository(region string) (*Repository, error) {
+	if r.Region != "" {
+		region = r.Region
+	}
+	repo, err := newRepository(r.Name, region)
+	if err != nil {
+		return nil, err
+	}
+	repo.Profile = r.Profile
+	return repo, nil
+}
@@ -0,0 +1,76 @@
+package codecommit
+
+import (
+	"testing"
+)
+
+// TestParseRemoteURL tests parsing of the git-remote-codecommit URL forms.
+func TestParseRemoteURL(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected RemoteURL
+	}{
+		{"codecommit://repo", RemoteURL{Name: "repo"}},
+		{"codecommit://dev@repo", RemoteURL{Profile: "dev", Name: "repo"}},
+		{"codecommit::eu-west-1://repo", RemoteURL{Region: "eu-west-1", Name: "repo"}},
+		{"us-east-1://dev@my.repo-1", RemoteURL{Region: "us-east-1", Profile: "dev", Name: "my.repo-1"}},
+		{"cn-north-1://repo", RemoteURL{Region: "cn-north-1", Name: "repo"}},
+	}
+	for _, test := range tests {
+		actual, err := ParseRemoteURL(test.url)
+		if err != nil {
+			t.Errorf("Failed to parse %q, err=%v", test.url, err)
+			continue
+		}
+		if *actual != test.expected {
+			t.Errorf("expected %v for %q, actual %v", test.expected, test.url, *actual)
+		}
+	}
+}
+
+// TestParseRemoteURLInvalid tests that malformed remote URLs are rejected.
+func TestParseRemoteURLInvalid(t *testing.T) {
+	for _, url := range []string{
+		"",
+		"repo",
+		"codecommit://",
+		"codecommit://@repo",
+		"codecommit://repo/path",
+		"nowhere://repo",
+	} {
+		if r, err := ParseRemoteURL(url); err == nil {
+			t.Errorf("expected error not returned for %q, actual %v", url, r)
+		}
+	}
+}
+
+// TestRemoteURLRepository tests the repository uses the region of the URL, or the default.
+func TestRemoteURLRepository(t *testing.T) {
+	tests := []struct {
+		url      string
+		region   string
+		expected string
+	}{
+		{"codecommit://repo", "us-east-1", "https://git-codecommit.us-east-1.amazonaws.com/v1/repos/repo"},
+		{"codecommit::cn-north-1://repo", "us-east-1", "https://git-codecommit.cn-north-1.amazonaws.com.cn/v1/repos/repo"},
+	}
+	for _, test := range tests {
+		r, err := ParseRemoteURL(test.url)
+		if err != nil {
+			t.Fatalf("Failed to parse %q, err=%v", test.url, err)
+		}
+		repo, err := r.Repository(test.region)
+		if err != nil {
+			t.Errorf("Failed to get repository for %q, err=%v", test.url, err)
+			continue
+		}
+		if actual := repo.URL(); actual != test.expected {
+			t.Errorf("expected %q, actual %q", test.expected, actual)
+		}
+	}
+
+	r := &RemoteURL{Name: "repo"}
+	if _, err := r.Repository(""); err == nil {
+		t.Errorf("expected error not returned without a region")
+	}
+}
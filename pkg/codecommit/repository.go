@@ -0,0 +1,138 @@
+package codecommit
+
+import (
+	"fmt"
+	nurl "net/url"
+	"strings"
+)
+
+const (
+	//repositoryPathPrefix is the path of repositories on CodeCommit Git endpoints
+	repositoryPathPrefix = "/v1/repos/"
+)
+
+//Repository is a canonical reference to a CodeCommit repository, see ParseRepository
+type Repository struct {
+	Endpoint
+
+	Name string
+	//AccountID is empty unless the repository was referenced by ARN
+	AccountID string
+	//Profile is empty unless the repository was referenced by a git-remote-codecommit URL with a profile
+	Profile string
+}
+
+//ParseRepository return the Repository for ref, which is one of:
+//	arn:aws:codecommit:eu-west-1:123456789012:repository
+//	repository
+//	codecommit::eu-west-1://[profile@]repository
+//	https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/repository
+//region is used for references which do not include a region.
+func ParseRepository(ref, region string) (*Repository, error) {
+	switch {
+	case strings.HasPrefix(ref, "arn:"):
+		return parseRepositoryARN(ref)
+	case strings.HasPrefix(ref, RemoteScheme+":"):
+		r, err := ParseRemoteURL(ref)
+		if err != nil {
+			return nil, err
+		}
+		return r.Repository(region)
+	case strings.Contains(ref, "://"):
+		return parseRepositoryURL(ref)
+	default:
+		return newRepository(ref, region)
+	}
+}
+
+//IsRepositoryReference return true if ref is in one of the forms accepted by
+//ParseRepository, it may still fail to parse.
+func IsRepositoryReference(ref string) bool {
+	switch {
+	case strings.HasPrefix(ref, "arn:"), strings.HasPrefix(ref, RemoteScheme+":"):
+		return true
+	case strings.Contains(ref, "://"):
+		return IsCodeCommitURL(ref)
+	default:
+		return repositoryNameRe.MatchString(ref)
+	}
+}
+
+//newRepository return the repository name in region's public endpoint
+func newRepository(name, region string) (*Repository, error) {
+	if !repositoryNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid CodeCommit repository name %q", name)
+	}
+	if region == "" {
+		return nil, fmt.Errorf("no region for CodeCommit repository %q, set it in the reference or the AWS config", name)
+	}
+	e, err := NewEndpoint(region, false)
+	if err != nil {
+		return nil, err
+	}
+	return &Repository{
+		Endpoint: *e,
+		Name:     name,
+	}, nil
+}
+
+//parseRepositoryARN parses arn:<partition>:codecommit:<region>:<account-id>:<repository>
+func parseRepositoryARN(arn string) (*Repository, error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[2] != "codecommit" {
+		return nil, fmt.Errorf("invalid CodeCommit repository ARN %q", arn)
+	}
+	r, err := newRepository(parts[5], parts[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid CodeCommit repository ARN %q: %v", arn, err)
+	}
+	if err := r.CheckARN(arn); err != nil {
+		return nil, err
+	}
+	r.AccountID = parts[4]
+	return r, nil
+}
+
+//parseRepositoryURL parses a CodeCommit HTTPS URL, keeping its endpoint
+func parseRepositoryURL(url string) (*Repository, error) {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid CodeCommit URL %q: scheme must be https", url)
+	}
+	e, err := ParseEndpoint(u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(u.Path, repositoryPathPrefix) {
+		return nil, fmt.Errorf("invalid CodeCommit URL %q: path must start with %s", url, repositoryPathPrefix)
+	}
+	name := strings.TrimSuffix(strings.TrimPrefix(u.Path, repositoryPathPrefix), "/")
+	if !repositoryNameRe.MatchString(name) {
+		return nil, fmt.Errorf("invalid CodeCommit URL %q: invalid repository name %q", url, name)
+	}
+	return &Repository{
+		Endpoint: *e,
+		Name:     name,
+	}, nil
+}
+
+//URL return the HTTPS URL of the repository
+func (r *Repository) URL() string {
+	u := nurl.URL{
+		Scheme: "https",
+		Host:   r.Host,
+		Path:   repositoryPathPrefix + r.Name,
+	}
+	return u.String()
+}
+
+//ARN return the ARN of the repository, or an empty string if the account is not known
+func (r *Repository) ARN() string {
+	if r.AccountID == "" {
+		return ""
+	}
+	return strings.Join([]string{"arn", r.Partition, "codecommit", r.Region, r.AccountID, r.Name}, ":")
+}
@@ -0,0 +1,100 @@
+package codecommit
+
+import (
+	"testing"
+)
+
+// TestParseRepository tests that each form of reference resolves to the same canonical repository.
+func TestParseRepository(t *testing.T) {
+	tests := []struct {
+		ref      string
+		region   string
+		expected Repository
+	}{
+		{
+			"arn:aws:codecommit:eu-west-1:123456789012:repo", "",
+			Repository{Name: "repo", AccountID: "123456789012"},
+		},
+		{
+			"repo", "eu-west-1",
+			Repository{Name: "repo"},
+		},
+		{
+			"codecommit::eu-west-1://dev@repo", "us-east-1",
+			Repository{Name: "repo", Profile: "dev"},
+		},
+		{
+			"codecommit://repo", "eu-west-1",
+			Repository{Name: "repo"},
+		},
+		{
+			"https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/repo", "us-east-1",
+			Repository{Name: "repo"},
+		},
+	}
+	for _, test := range tests {
+		actual, err := ParseRepository(test.ref, test.region)
+		if err != nil {
+			t.Errorf("Failed to parse %q, err=%v", test.ref, err)
+			continue
+		}
+		expected := test.expected
+		expected.Endpoint = Endpoint{
+			Host:      "git-codecommit.eu-west-1.amazonaws.com",
+			Region:    "eu-west-1",
+			Partition: "aws",
+		}
+		if *actual != expected {
+			t.Errorf("expected %v for %q, actual %v", expected, test.ref, *actual)
+		}
+		if url := actual.URL(); url != "https://git-codecommit.eu-west-1.amazonaws.com/v1/repos/repo" {
+			t.Errorf("unexpected URL %q for %q", url, test.ref)
+		}
+	}
+}
+
+// TestParseRepositoryEndpoint tests that the endpoint of HTTPS URLs is kept.
+func TestParseRepositoryEndpoint(t *testing.T) {
+	url := "https://vpce-0abc-xyz.git-codecommit.us-east-1.vpce.amazonaws.com/v1/repos/repo"
+	r, err := ParseRepository(url, "")
+	if err != nil {
+		t.Fatalf("Failed to parse %q, err=%v", url, err)
+	}
+	if actual := r.URL(); actual != url {
+		t.Errorf("expected %q, actual %q", url, actual)
+	}
+}
+
+// TestParseRepositoryInvalid tests that malformed references are rejected.
+func TestParseRepositoryInvalid(t *testing.T) {
+	for _, ref := range []string{
+		"repo",
+		"bad/name",
+		"arn:aws:codecommit:eu-west-1:123456789012",
+		"arn:aws:s3:eu-west-1:123456789012:repo",
+		"arn:aws:codecommit:cn-north-1:123456789012:repo",
+		"http://git-codecommit.eu-west-1.amazonaws.com/v1/repos/repo",
+		"https://git-codecommit.eu-west-1.amazonaws.com/repo",
+		"https://github.com/v1/repos/repo",
+	} {
+		if r, err := ParseRepository(ref, ""); err == nil {
+			t.Errorf("expected error not returned for %q, actual %v", ref, r)
+		}
+	}
+}
+
+// TestRepositoryARN tests the ARN is only available when the account is known.
+func TestRepositoryARN(t *testing.T) {
+	arn := "arn:aws-cn:codecommit:cn-north-1:123456789012:repo"
+	r, err := ParseRepository(arn, "")
+	if err != nil {
+		t.Fatalf("Failed to parse %q, err=%v", arn, err)
+	}
+	if actual := r.ARN(); actual != arn {
+		t.Errorf("expected %q, actual %q", arn, actual)
+	}
+	r.AccountID = ""
+	if actual := r.ARN(); actual != "" {
+		t.Errorf("expected no ARN, actual %q", actual)
+	}
+}
@@ -38,19 +38,30 @@ func (ctx *SigningCtx) buildTime() {
 	ctx.formattedShortTime = ctx.Time.UTC().Format(shortTimeFormat)
 }
 
-func (ctx *SigningCtx) getCanonicalString() string {
+//CanonicalRequest return the canonical form of the git request which is signed,
+//the host is signed without its port and in lower case for every kind of endpoint.
+func (ctx *SigningCtx) CanonicalRequest() string {
 	method := "GIT"
-	canonicalString := fmt.Sprintf("%s\n%s\n\nhost:%s\n\nhost\n", method, ctx.url.Path, ctx.url.Hostname())
+	return fmt.Sprintf("%s\n%s\n\nhost:%s\n\nhost\n", method, ctx.url.Path, strings.ToLower(ctx.url.Hostname()))
+}
+
+//Scope return the credential scope of the signature, date/region/service/aws4_request
+func (ctx *SigningCtx) Scope() string {
+	return strings.Join([]string{
+		ctx.formattedShortTime,
+		ctx.Region,
+		ctx.ServiceName,
+		ctx.requestType,
+	}, "/")
+}
+
+//StringToSign return the string the signing key signs to produce the password
+func (ctx *SigningCtx) StringToSign() string {
 	return strings.Join([]string{
 		ctx.authHeaderPrefix,
 		ctx.formattedTime,
-		strings.Join([]string{
-			ctx.formattedShortTime,
-			ctx.Region,
-			ctx.ServiceName,
-			ctx.requestType,
-		}, "/"),
-		fmt.Sprintf("%x", sha256.Sum256([]byte(canonicalString))),
+		ctx.Scope(),
+		fmt.Sprintf("%x", sha256.Sum256([]byte(ctx.CanonicalRequest()))),
 	}, "\n")
 }
 
@@ -60,7 +71,7 @@ func (ctx *SigningCtx) signCodeCommitRequest() string {
 	for _, param := range params {
 		hMAC([]byte(param))
 	}
-	sig := hex.EncodeToString(hMAC([]byte(ctx.getCanonicalString())))
+	sig := hex.EncodeToString(hMAC([]byte(ctx.StringToSign())))
 
 	return fmt.Sprintf("%sZ%s", ctx.formattedTime, sig)
 }
@@ -42,3 +42,101 @@ func TestNewSigningContext(t *testing.T) {
 		t.Fatalf("Expected signature %v, actual %v", expected, actual)
 	}
 }
+
+// TestSigningContextEndpoints tests the signatures for each form of CodeCommit endpoint. The string to sign and
+// signature of each were computed independently of this package, following the SigV4 specification with Python's
+// hashlib and hmac modules, from the canonical request "GIT\n<path>\n\nhost:<host>\n\nhost\n".
+func TestSigningContextEndpoints(t *testing.T) {
+	tests := []struct {
+		url          string
+		region       string
+		stringToSign string
+		expected     string
+	}{
+		{
+			"https://git-codecommit-fips.us-east-1.amazonaws.com/v1/repos/test-lcc2",
+			"us-east-1",
+			"AWS4-HMAC-SHA256\n20060102T150405\n20060102/us-east-1/codecommit/aws4_request\n" +
+				"3a8996c30bd35e9054268d5777e19e0471ff1f7b9bcbe7963bc39cd7283f08da",
+			"20060102T150405Z85063dd7f2af7c6705640a2ef4ec4b31a1139e095d776c51b355ffabe7f21149",
+		},
+		{
+			"https://vpce-0abc-xyz.git-codecommit.us-east-1.vpce.amazonaws.com/v1/repos/test-lcc2",
+			"us-east-1",
+			"AWS4-HMAC-SHA256\n20060102T150405\n20060102/us-east-1/codecommit/aws4_request\n" +
+				"5543aa62a2de8cff838ac204f970b97566993fc51de85e4a8284f0862991c078",
+			"20060102T150405Z8149bf7864b185e6cb0b6b2ec5e228d042939f44d6e73100ed608ba9490914b9",
+		},
+		{
+			"https://vpce-0abc-xyz-us-east-1a.git-codecommit.us-east-1.vpce.amazonaws.com/v1/repos/test-lcc2",
+			"us-east-1",
+			"AWS4-HMAC-SHA256\n20060102T150405\n20060102/us-east-1/codecommit/aws4_request\n" +
+				"13badc200df4423cb0e933be9542f35972ce37b275a16e8dd1a3d3ac2d906a52",
+			"20060102T150405Z71e1a2c5963c400c0ca6eae07de2794ff64f9c97810c844fdadb9f2a7ad0ebf3",
+		},
+		{
+			"https://git-codecommit.cn-north-1.amazonaws.com.cn/v1/repos/test-lcc2",
+			"cn-north-1",
+			"AWS4-HMAC-SHA256\n20060102T150405\n20060102/cn-north-1/codecommit/aws4_request\n" +
+				"fd488787f824995e20452fbf17effb32dbe8b08609ec69876491a28e65f53071",
+			"20060102T150405Z9307b34ed688fc4bf91b0fbe9726dab19f34e62fe72052ec1ac26a8e1c0d4140",
+		},
+		{
+			"https://git-codecommit.cn-northwest-1.amazonaws.com.cn/v1/repos/test-lcc2",
+			"cn-northwest-1",
+			"AWS4-HMAC-SHA256\n20060102T150405\n20060102/cn-northwest-1/codecommit/aws4_request\n" +
+				"2baaf20ac173665d8a28a31ea2c318d76f1217ffb06c9becc9ff66e0257679a2",
+			"20060102T150405Zd3593024f804ef096ba6c6dac654da394319a21dcc431b5d4de3f2cd8923491e",
+		},
+		{
+			"https://git-codecommit.us-gov-west-1.amazonaws.com/v1/repos/test-lcc2",
+			"us-gov-west-1",
+			"AWS4-HMAC-SHA256\n20060102T150405\n20060102/us-gov-west-1/codecommit/aws4_request\n" +
+				"e9d5f1a1b4070dfb631bedfe77b98513fc17dd480b2759c7808ce7bf9a635ef3",
+			"20060102T150405Zd0551787acdc417a3eeae6619a5eae29b55ef3e0ced3010a074b6826377f3476",
+		},
+		{
+			"https://git-codecommit-fips.us-gov-west-1.amazonaws.com/v1/repos/test-lcc2",
+			"us-gov-west-1",
+			"AWS4-HMAC-SHA256\n20060102T150405\n20060102/us-gov-west-1/codecommit/aws4_request\n" +
+				"405dc1439fda6c2fc925afabcce0fb9c2524acca9b5e2924a67486d98973b0c6",
+			"20060102T150405Zc2f8f9adcf2da752533eb6d8604b96362d42b1983efae828f30be069bcd2ddeb",
+		},
+		{
+			// the port and case of the host are not signed
+			"https://VPCE-0abc-xyz.git-codecommit.us-east-1.vpce.amazonaws.com:443/v1/repos/test-lcc2",
+			"us-east-1",
+			"AWS4-HMAC-SHA256\n20060102T150405\n20060102/us-east-1/codecommit/aws4_request\n" +
+				"5543aa62a2de8cff838ac204f970b97566993fc51de85e4a8284f0862991c078",
+			"20060102T150405Z8149bf7864b185e6cb0b6b2ec5e228d042939f44d6e73100ed608ba9490914b9",
+		},
+	}
+
+	credValues := credentials.Value{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "SECRET",
+	}
+	tf := "20060102T150405"
+	signTime, err := time.Parse(tf, tf)
+	if err != nil {
+		t.Fatalf("Failed to parse time %v (err: %v)", tf, err)
+	}
+
+	for _, test := range tests {
+		u, _ := url.Parse(test.url)
+		region, err := ParseRegion(u.Host)
+		if err != nil {
+			t.Fatalf("Failed to parse region for %v (err: %v)", test.url, err)
+		}
+		if region != test.region {
+			t.Errorf("Expected region %v for %v, actual %v", test.region, test.url, region)
+		}
+		ctx := NewSigningContext(u, region, endpoints.CodecommitServiceID, credValues, signTime)
+		if actual := ctx.StringToSign(); actual != test.stringToSign {
+			t.Errorf("Expected string to sign %q for %v, actual %q", test.stringToSign, test.url, actual)
+		}
+		if actual := ctx.signCodeCommitRequest(); actual != test.expected {
+			t.Errorf("Expected signature %v for %v, actual %v", test.expected, test.url, actual)
+		}
+	}
+}
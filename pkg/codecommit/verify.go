@@ -0,0 +1,159 @@
+package codecommit
+
+import (
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	nurl "net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+//VerificationError reports which component of a CodeCommit username or
+//password does not match the request it was presented for.
+type VerificationError struct {
+	//Component is one of "url", "username", "password", "time", "region", "host", "path" or "signature"
+	Component string
+	Message   string
+}
+
+func (e *VerificationError) Error() string {
+	return fmt.Sprintf("%s does not match: %s", e.Component, e.Message)
+}
+
+//VerifyCodeCommitPassword checks that password was signed for url with
+//secret, the secret access key of the access key ID in username, and is still
+//accepted by CodeCommit. A *VerificationError is returned on mismatch.
+func VerifyCodeCommitPassword(url, username, password, secret string) error {
+	return verifyPassword(url, username, password, secret, time.Now())
+}
+
+func verifyPassword(url, username, password, secret string, now time.Time) error {
+	u, err := nurl.Parse(url)
+	if err != nil {
+		return &VerificationError{"url", err.Error()}
+	}
+	e, err := ParseEndpoint(u.Host)
+	if err != nil {
+		return &VerificationError{"url", err.Error()}
+	}
+
+	parts := strings.SplitN(username, "%", 2)
+	if parts[0] == "" {
+		return &VerificationError{"username", "no access key ID, expected <access key ID>[%<session token>]"}
+	}
+	creds := credentials.Value{AccessKeyID: parts[0], SecretAccessKey: secret}
+	if len(parts) == 2 {
+		creds.SessionToken = parts[1]
+	}
+
+	signTime, err := parsePassword(password)
+	if err != nil {
+		return &VerificationError{"password", err.Error()}
+	}
+
+	sign := func(u *nurl.URL, region string) string {
+		ctx := NewSigningContext(u, region, endpoints.CodecommitServiceID, creds, signTime)
+		return ctx.signCodeCommitRequest()
+	}
+	if !hmac.Equal([]byte(sign(u, e.Region)), []byte(password)) {
+		if err := diagnoseSignature(u, e, password, sign); err != nil {
+			return err
+		}
+		return &VerificationError{"signature",
+			fmt.Sprintf("password was not signed for %s with the secret access key of %s", url, creds.AccessKeyID)}
+	}
+
+	if age := now.Sub(signTime); age > SignatureLifetime {
+		return &VerificationError{"time",
+			fmt.Sprintf("password signed at %v expired %v ago", signTime, age-SignatureLifetime)}
+	}
+	if signTime.After(now.Add(MaxClockSkew)) {
+		return &VerificationError{"time",
+			fmt.Sprintf("password signed at %v is %v in the future", signTime, signTime.Sub(now))}
+	}
+	return nil
+}
+
+//parsePassword return the signing time of password, <yyyymmddThhmmss>Z<hex signature>
+func parsePassword(password string) (time.Time, error) {
+	i := strings.Index(password, "Z")
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("expected <%s>Z<signature>", timeFormat)
+	}
+	signTime, err := time.Parse(timeFormat, password[:i])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid signing time %q", password[:i])
+	}
+	if sig, err := hex.DecodeString(password[i+1:]); err != nil || len(sig) != 32 {
+		return time.Time{}, fmt.Errorf("signature is not 64 hex digits")
+	}
+	return signTime, nil
+}
+
+//diagnoseSignature return the component of u which password was signed with
+//a different value for, or nil if no likely alternative matches.
+func diagnoseSignature(u *nurl.URL, e *Endpoint, password string, sign func(*nurl.URL, string) string) error {
+	matches := func(v *nurl.URL, region string) bool {
+		return hmac.Equal([]byte(sign(v, region)), []byte(password))
+	}
+
+	for _, path := range pathVariants(u.Path) {
+		v := *u
+		v.Path = path
+		if matches(&v, e.Region) {
+			return &VerificationError{"path", fmt.Sprintf("password was signed for path %q, not %q", path, u.Path)}
+		}
+	}
+
+	for _, fips := range []bool{false, true} {
+		public, err := NewEndpoint(e.Region, fips)
+		if err != nil || public.Host == e.Host {
+			continue
+		}
+		v := *u
+		v.Host = public.Host
+		if matches(&v, e.Region) {
+			return &VerificationError{"host", fmt.Sprintf("password was signed for host %q, not %q", public.Host, e.Host)}
+		}
+	}
+
+	p, err := partitionForRegion(e.Region)
+	if err != nil {
+		return nil
+	}
+	regions := make([]string, 0, len(p.Regions()))
+	for id := range p.Regions() {
+		regions = append(regions, id)
+	}
+	sort.Strings(regions)
+	for _, region := range regions {
+		if region == e.Region {
+			continue
+		}
+		v := *u
+		if other, err := NewEndpoint(region, e.FIPS); err == nil && e.VPCEndpoint == "" {
+			v.Host = other.Host
+		}
+		if matches(&v, region) || matches(u, region) {
+			return &VerificationError{"region", fmt.Sprintf("password was signed for region %q, not %q", region, e.Region)}
+		}
+	}
+	return nil
+}
+
+//pathVariants return paths git or a user commonly substitutes for path
+func pathVariants(path string) []string {
+	trimmed := strings.TrimSuffix(strings.TrimSuffix(path, "/"), ".git")
+	variants := []string{}
+	for _, v := range []string{trimmed, trimmed + "/", trimmed + ".git", trimmed + ".git/"} {
+		if v != path {
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
@@ -0,0 +1,53 @@
+package codecommit
+
+import (
+	"testing"
+	"time"
+)
+
+// TestVerifyPassword tests that the mismatching component of a password is reported.
+func TestVerifyPassword(t *testing.T) {
+	signTime := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	signedURL := "https://git-codecommit.ca-central-1.amazonaws.com/v1/repos/test-lcc2"
+
+	tests := []struct {
+		url       string
+		username  string
+		password  string
+		secret    string
+		now       time.Time
+		component string
+	}{
+		{signedURL, "AKID", expectedSignature, "SECRET", signTime.Add(time.Minute), ""},
+		{signedURL, "AKID%TOKEN", expectedSignature, "SECRET", signTime.Add(time.Minute), ""},
+		{"https://git-codecommit.ca-central-1.amazonaws.com:443/v1/repos/test-lcc2", "AKID", expectedSignature, "SECRET", signTime, ""},
+		{"git-codecommit", "AKID", expectedSignature, "SECRET", signTime, "url"},
+		{signedURL, "%TOKEN", expectedSignature, "SECRET", signTime, "username"},
+		{signedURL, "AKID", "20060102T150405", "SECRET", signTime, "password"},
+		{signedURL, "AKID", "2006-01-02Z" + expectedSignature[16:], "SECRET", signTime, "password"},
+		{signedURL, "AKID", expectedSignature, "SECRET", signTime.Add(SignatureLifetime + time.Second), "time"},
+		{signedURL, "AKID", expectedSignature, "SECRET", signTime.Add(-time.Hour), "time"},
+		{signedURL + "/", "AKID", expectedSignature, "SECRET", signTime, "path"},
+		{signedURL + ".git", "AKID", expectedSignature, "SECRET", signTime, "path"},
+		{"https://git-codecommit-fips.ca-central-1.amazonaws.com/v1/repos/test-lcc2", "AKID", expectedSignature, "SECRET", signTime, "host"},
+		{"https://git-codecommit.us-east-1.amazonaws.com/v1/repos/test-lcc2", "AKID", expectedSignature, "SECRET", signTime, "region"},
+		{signedURL, "AKID", expectedSignature, "OTHER", signTime, "signature"},
+	}
+	for _, test := range tests {
+		err := verifyPassword(test.url, test.username, test.password, test.secret, test.now)
+		if test.component == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", test.url, err)
+			}
+			continue
+		}
+		verr, ok := err.(*VerificationError)
+		if !ok {
+			t.Errorf("%s: expected %s mismatch, actual %v", test.url, test.component, err)
+			continue
+		}
+		if verr.Component != test.component {
+			t.Errorf("%s: expected %s mismatch, actual %v", test.url, test.component, verr)
+		}
+	}
+}